@@ -4,8 +4,11 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"hash"
+	"sort"
+	"sync"
 
 	"github.com/gofrs/uuid"
 )
@@ -21,6 +24,15 @@ const (
 	CEFuncID ceSetIDType = "func" // set by WithFields or FilterFunc
 )
 
+// ceModeType provides cloudevents content mode type
+type ceModeType string
+
+// Types of cloudevents content modes for kafka
+const (
+	CEStructured ceModeType = "structured" // default - attributes in body
+	CEBinary     ceModeType = "binary"     // attributes in record headers
+)
+
 // CloudEventsConfiguration provides cloudevents configuration type
 type CloudEventsConfiguration struct {
 	SetID           ceSetIDType
@@ -29,6 +41,7 @@ type CloudEventsConfiguration struct {
 	SpecVersion     string
 	Type            string
 	SetSubjectLevel bool
+	Mode            ceModeType
 }
 
 // Keys for cloudevents fields, values must be non-empty strings
@@ -44,6 +57,24 @@ const (
 	CEDataKey         = "data"            // Optional - no specific format
 )
 
+// Kafka protocol binding header names for binary content mode
+const (
+	CEHeaderPrefix    = "ce_"          // Prefix for attribute headers
+	ContentTypeHeader = "content-type" // Set from datacontenttype
+)
+
+// Content types for binary content mode data
+const (
+	ceTextContentType = "text/plain; charset=utf-8"
+	ceJSONContentType = "application/json"
+)
+
+// ceAttribute provides a cloudevents attribute in binary content mode
+type ceAttribute struct {
+	name  string
+	value string
+}
+
 type incrementalFn func() string
 
 // CloudEvents provides the cloudevents object type
@@ -52,6 +83,7 @@ type CloudEvents struct {
 	fields           LogFields
 	genIncrementalID incrementalFn
 	hmacHash         hash.Hash
+	mut              sync.Mutex // sinks generate ids concurrently
 }
 
 // incrementalID returns function that returns IDs starting with zero
@@ -103,6 +135,9 @@ func newCloudEvents(config CloudEventsConfiguration) *CloudEvents {
 
 // ceGetID returns the cloudevents id field for the message
 func (ce *CloudEvents) ceGetID(msgMap map[string]interface{}) (string, error) {
+	ce.mut.Lock()
+	defer ce.mut.Unlock()
+
 	switch ce.config.SetID {
 	case CEFuncID:
 		// set when using FilterFn or WithFields to supply id
@@ -124,16 +159,129 @@ func (ce *CloudEvents) ceGetID(msgMap map[string]interface{}) (string, error) {
 	}
 }
 
+// ceRecordID returns the cloudevents id for a log record with message
+// used to give a record the same id in every sink with cloudevents format
+func (ce *CloudEvents) ceRecordID(message string) (string, error) {
+	return ce.ceGetID(map[string]interface{}{CEDataKey: message})
+}
+
+// ceIDFormat returns true if records of a sink with format need the id
+// gelf records use the id as _message_id if the gelf config enables it
+func ceIDFormat(config LoggerConfiguration, format FormatType) bool {
+	return format == CEFormat ||
+		(format == GELFFormat && config.GELFCfg.EnableID)
+}
+
+// ceSharedIDs returns true if sinks other than kafka use cloudevents ids
+// each record then needs one id that all sinks with cloudevents ids use
+// the id is set before the record reaches any sink, so the other sinks
+// get the same id kafka would otherwise generate for the record
+func ceSharedIDs(config LoggerConfiguration) bool {
+	return (config.EnableConsole && ceIDFormat(config, config.ConsoleFormat)) ||
+		(config.EnableFile && ceIDFormat(config, config.FileFormat)) ||
+		(config.EnableHTTP && ceIDFormat(config, config.HTTPFormat)) ||
+		(config.EnableLoki && ceIDFormat(config, config.LokiFormat)) ||
+		(config.EnableGELF && ceIDFormat(config, GELFFormat))
+}
+
 // ceAddFields adds the cloudevents id field to the message
+// an id already set for a console or file sink is kept
 func (ce *CloudEvents) ceAddFields(msgMap map[string]interface{}) error {
 	// Other cloudevents fields could be added here based on config
 
-	id, err := ce.ceGetID(msgMap)
-	if err != nil {
-		return err
-	}
-	if id != "" {
-		msgMap[string(CEIDKey)] = id
+	if _, ok := msgMap[CEIDKey]; !ok {
+		id, err := ce.ceGetID(msgMap)
+		if err != nil {
+			return err
+		}
+		if id != "" {
+			msgMap[string(CEIDKey)] = id
+		}
 	}
+	ceAddTraceFields(msgMap)
 	return nil
 }
+
+// ceAttributeName returns true if name is a valid cloudevents attribute name
+// names must consist of lowercase letters and digits only
+func ceAttributeName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// ceBinaryFields splits the message into attributes and data for binary
+// content mode, fields with valid attribute names become attributes
+// other fields are kept in the data, which is then a JSON object
+// returns attributes sorted by name, the data and its content type
+func (ce *CloudEvents) ceBinaryFields(msgMap map[string]interface{}) (
+	[]ceAttribute, []byte, string, error) {
+
+	var attributes []ceAttribute
+	var data []byte
+	var contentType string
+	var err error
+
+	dataValue := msgMap[CEDataKey]
+	fields := make(map[string]interface{})
+	for key, value := range msgMap {
+		if key == CEDataKey || key == CEDataContentType {
+			continue
+		}
+		if !ceAttributeName(key) {
+			fields[key] = value
+			continue
+		}
+		attribute := ceAttribute{name: key}
+		if str, ok := value.(string); ok {
+			attribute.value = str
+		} else {
+			bytes, err := json.Marshal(value)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			attribute.value = string(bytes)
+		}
+		attributes = append(attributes, attribute)
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].name < attributes[j].name
+	})
+
+	if len(fields) > 0 {
+		// object data keeps its own keys, other data is kept under data
+		if object, ok := dataValue.(map[string]interface{}); ok {
+			for key, value := range object {
+				fields[key] = value
+			}
+		} else if dataValue != nil {
+			fields[CEDataKey] = dataValue
+		}
+		if data, err = json.Marshal(fields); err != nil {
+			return nil, nil, "", err
+		}
+		return attributes, data, ceJSONContentType, nil
+	}
+
+	switch value := dataValue.(type) {
+	case nil:
+	case string:
+		data = []byte(value)
+		contentType = ceTextContentType
+	default:
+		if data, err = json.Marshal(value); err != nil {
+			return nil, nil, "", err
+		}
+		contentType = ceJSONContentType
+	}
+	if value, ok := msgMap[CEDataContentType].(string); ok {
+		contentType = value
+	}
+	return attributes, data, contentType, nil
+}
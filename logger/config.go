@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,7 +9,9 @@ import (
 	"os"
 	"os/signal"
 	"os/user"
+	"regexp"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -40,6 +43,12 @@ const (
 	KafkaEnvPrefix       = "PRKAFKA"
 	CloudEventsEnvPrefix = "PRCE"
 	RotationEnvPrefix    = "PRROT"
+	SyslogEnvPrefix      = "PRSYSLOG"
+	HTTPEnvPrefix        = "PRHTTP"
+	LokiEnvPrefix        = "PRLOKI"
+	ElasticEnvPrefix     = "PRELASTIC"
+	GELFEnvPrefix        = "PRGELF"
+	OTLPEnvPrefix        = "PROTLP"
 )
 
 // Default config file name without extension
@@ -56,6 +65,13 @@ const (
 	errKafka       = "Could not create kafka configuration"
 	errCloudevents = "Could not create cloudevents configuration"
 	errRotation    = "Could not create rotation configuration"
+	errSyslog      = "Could not create syslog configuration"
+	errHTTP        = "Could not create http configuration"
+	errLoki        = "Could not create loki configuration"
+	errElastic     = "Could not create elasticsearch configuration"
+	errGELF        = "Could not create gelf configuration"
+	errOTLP        = "Could not create otlp configuration"
+	errReload      = "Could not reload logger configuration"
 )
 
 // logger global for go log pkg emulation
@@ -82,6 +98,16 @@ var defaultLoggerConfiguration = LoggerConfiguration{
 	FileFormat:        JSONFormat,
 	FileLocation:      "pavedroad.log",
 	EnableRotation:    false,
+	EnableSyslog:      false,
+	EnableHTTP:        false,
+	HTTPFormat:        CEFormat,
+	EnableLoki:        false,
+	LokiFormat:        JSONFormat,
+	EnableElastic:     false,
+	ElasticFormat:     ECSFormat,
+	EnableGELF:        false,
+	EnableOTLP:        false,
+	ReloadMode:        ReloadNone,
 	EnableDebug:       false,
 }
 
@@ -99,7 +125,20 @@ var defaultProducerConfiguration = ProducerConfiguration{
 	MetaRetryMax:  10,
 	MetaRetryFreq: 2000 * time.Millisecond,
 	EnableTLS:     false,
+	TLSMinVersion: TLSVersion12,
+	EnableSASL:    false,
+	SASLMechanism: SASLPlain,
 	EnableDebug:   false,
+	Fallback:      FallbackNone,
+	EnableSpool:   false,
+	SpoolCfg:      defaultSpoolConfiguration,
+}
+
+var defaultSpoolConfiguration = SpoolConfiguration{
+	Directory:  "pavedroad.spool",
+	MaxBytes:   100 * 1024 * 1024,
+	MaxAge:     24 * time.Hour,
+	ReplayFreq: 5 * time.Second,
 }
 
 var defaultCloudEventsConfiguration = CloudEventsConfiguration{
@@ -109,6 +148,7 @@ var defaultCloudEventsConfiguration = CloudEventsConfiguration{
 	SpecVersion:     "1.0",
 	Type:            "io.pavedroad.cloudevents.log",
 	SetSubjectLevel: true,
+	Mode:            CEStructured,
 }
 
 var defaultRotationConfiguration = RotationConfiguration{
@@ -119,6 +159,68 @@ var defaultRotationConfiguration = RotationConfiguration{
 	Compress:   false,
 }
 
+var defaultSyslogConfiguration = SyslogConfiguration{
+	Network:  SyslogUDP,
+	Address:  "localhost:514",
+	Facility: "local0",
+	Format:   SyslogRFC5424,
+	Framing:  SyslogOctetCounting,
+	SDID:     "fields@32473", // example enterprise number from RFC 5424
+}
+
+var defaultHTTPConfiguration = HTTPConfiguration{
+	URL:       "http://localhost:8080/logs",
+	Mode:      HTTPBatch,
+	BatchSize: 100,
+	FlushFreq: 1000 * time.Millisecond,
+	QueueSize: 10,
+	Timeout:   10 * time.Second,
+	RetryMax:  5,
+	RetryFreq: 500 * time.Millisecond,
+}
+
+var defaultLokiConfiguration = LokiConfiguration{
+	URL:       "http://localhost:3100/loki/api/v1/push",
+	Encoding:  LokiProtobuf,
+	BatchSize: 100,
+	FlushFreq: 1000 * time.Millisecond,
+	QueueSize: 10,
+	Timeout:   10 * time.Second,
+	RetryMax:  5,
+	RetryFreq: 500 * time.Millisecond,
+}
+
+var defaultElasticConfiguration = ElasticConfiguration{
+	URL:       "http://localhost:9200",
+	Index:     "logs-%{service}-%{+2006.01.02}",
+	BatchSize: 100,
+	FlushFreq: 1000 * time.Millisecond,
+	QueueSize: 10,
+	Timeout:   10 * time.Second,
+	RetryMax:  5,
+	RetryFreq: 500 * time.Millisecond,
+}
+
+var defaultGELFConfiguration = GELFConfiguration{
+	Network:     GELFUDP,
+	Address:     "localhost:12201",
+	Compression: GELFGzip,
+	ChunkSize:   1420, // fits an ethernet frame
+	EnableID:    false,
+}
+
+var defaultOTLPConfiguration = OTLPConfiguration{
+	Protocol:  OTLPGRPC,
+	Endpoint:  "localhost:4317",
+	Insecure:  true,
+	BatchSize: 100,
+	FlushFreq: 1000 * time.Millisecond,
+	QueueSize: 10,
+	Timeout:   10 * time.Second,
+	RetryMax:  5,
+	RetryFreq: 500 * time.Millisecond,
+}
+
 // DefaultLoggerCfg returns default log configuration
 func DefaultLoggerCfg() LoggerConfiguration {
 	return defaultLoggerConfiguration
@@ -134,17 +236,58 @@ func DefaultCloudEventsCfg() CloudEventsConfiguration {
 	return defaultCloudEventsConfiguration
 }
 
+// DefaultSpoolCfg returns default kafka spool configuration
+func DefaultSpoolCfg() SpoolConfiguration {
+	return defaultSpoolConfiguration
+}
+
 // DefaultRotationCfg returns default cloudevents configuration
 func DefaultRotationCfg() RotationConfiguration {
 	return defaultRotationConfiguration
 }
 
+// DefaultSyslogCfg returns default syslog configuration
+func DefaultSyslogCfg() SyslogConfiguration {
+	return defaultSyslogConfiguration
+}
+
+// DefaultHTTPCfg returns default http sink configuration
+func DefaultHTTPCfg() HTTPConfiguration {
+	return defaultHTTPConfiguration
+}
+
+// DefaultLokiCfg returns default loki sink configuration
+func DefaultLokiCfg() LokiConfiguration {
+	return defaultLokiConfiguration
+}
+
+// DefaultElasticCfg returns default elasticsearch sink configuration
+func DefaultElasticCfg() ElasticConfiguration {
+	return defaultElasticConfiguration
+}
+
+// DefaultGELFCfg returns default gelf configuration
+func DefaultGELFCfg() GELFConfiguration {
+	return defaultGELFConfiguration
+}
+
+// DefaultOTLPCfg returns default otlp exporter configuration
+func DefaultOTLPCfg() OTLPConfiguration {
+	return defaultOTLPConfiguration
+}
+
 // DefaultLoggerCfg returns default log configuration
 func DefaultCompleteCfg() *LoggerConfiguration {
 	config := defaultLoggerConfiguration
 	config.CloudEventsCfg = defaultCloudEventsConfiguration
 	config.KafkaProducerCfg = defaultProducerConfiguration
 	config.RotationCfg = defaultRotationConfiguration
+	config.SyslogCfg = defaultSyslogConfiguration
+	config.HTTPCfg = defaultHTTPConfiguration
+	config.LokiCfg = defaultLokiConfiguration
+	config.ElasticCfg = defaultElasticConfiguration
+	config.GELFCfg = defaultGELFConfiguration
+	config.OTLPCfg = defaultOTLPConfiguration
 	return &config
 }
 
@@ -210,6 +353,8 @@ func GetLoggerConfiguration(cfgType configType,
 	// read config file and/or environment to override defaults
 	// single config file covers basic log config and all sub configs
 	// only gets environment overrides for the basic log config
+	// sub config values from the config file are the defaults for the
+	// sub config environment overrides that follow
 	err = FillConfiguration(DefaultCompleteCfg(), config, cfgType, cfgFileName,
 		LogEnvPrefix)
 	if err != nil {
@@ -218,7 +363,7 @@ func GetLoggerConfiguration(cfgType configType,
 
 	// get environment overrides for the kafka sub config
 	kafkaConfig := new(ProducerConfiguration)
-	err = FillConfiguration(DefaultProducerCfg(), kafkaConfig, EnvConfig, "",
+	err = FillConfiguration(config.KafkaProducerCfg, kafkaConfig, EnvConfig, "",
 		KafkaEnvPrefix)
 	if err == nil {
 		config.KafkaProducerCfg = *kafkaConfig
@@ -231,7 +376,7 @@ func GetLoggerConfiguration(cfgType configType,
 
 	// get environment overrides for the cloudevents sub config
 	ceConfig := new(CloudEventsConfiguration)
-	err = FillConfiguration(DefaultCloudEventsCfg(), ceConfig, EnvConfig, "",
+	err = FillConfiguration(config.CloudEventsCfg, ceConfig, EnvConfig, "",
 		CloudEventsEnvPrefix)
 	if err == nil {
 		config.CloudEventsCfg = *ceConfig
@@ -245,7 +390,7 @@ func GetLoggerConfiguration(cfgType configType,
 
 	// get environment overrides for the rotation sub config
 	rotConfig := new(RotationConfiguration)
-	err = FillConfiguration(DefaultRotationCfg(), rotConfig, EnvConfig, "",
+	err = FillConfiguration(config.RotationCfg, rotConfig, EnvConfig, "",
 		RotationEnvPrefix)
 	if err == nil {
 		config.RotationCfg = *rotConfig
@@ -256,6 +401,90 @@ func GetLoggerConfiguration(cfgType configType,
 		return cfg, fmt.Errorf("%s: %s %w\n", errRotation, err.Error(),
 			errSetting)
 	}
+
+	// get environment overrides for the syslog sub config
+	syslogConfig := new(SyslogConfiguration)
+	err = FillConfiguration(config.SyslogCfg, syslogConfig, EnvConfig, "",
+		SyslogEnvPrefix)
+	if err == nil {
+		config.SyslogCfg = *syslogConfig
+	} else {
+		if config.EnableSyslog {
+			errSetting = ErrFatal
+		}
+		return cfg, fmt.Errorf("%s: %s %w\n", errSyslog, err.Error(),
+			errSetting)
+	}
+
+	// get environment overrides for the http sub config
+	httpConfig := new(HTTPConfiguration)
+	err = FillConfiguration(config.HTTPCfg, httpConfig, EnvConfig, "",
+		HTTPEnvPrefix)
+	if err == nil {
+		config.HTTPCfg = *httpConfig
+	} else {
+		if config.EnableHTTP {
+			errSetting = ErrFatal
+		}
+		return cfg, fmt.Errorf("%s: %s %w\n", errHTTP, err.Error(),
+			errSetting)
+	}
+
+	// get environment overrides for the loki sub config
+	lokiConfig := new(LokiConfiguration)
+	err = FillConfiguration(config.LokiCfg, lokiConfig, EnvConfig, "",
+		LokiEnvPrefix)
+	if err == nil {
+		config.LokiCfg = *lokiConfig
+	} else {
+		if config.EnableLoki {
+			errSetting = ErrFatal
+		}
+		return cfg, fmt.Errorf("%s: %s %w\n", errLoki, err.Error(),
+			errSetting)
+	}
+
+	// get environment overrides for the elasticsearch sub config
+	elasticConfig := new(ElasticConfiguration)
+	err = FillConfiguration(config.ElasticCfg, elasticConfig, EnvConfig, "",
+		ElasticEnvPrefix)
+	if err == nil {
+		config.ElasticCfg = *elasticConfig
+	} else {
+		if config.EnableElastic {
+			errSetting = ErrFatal
+		}
+		return cfg, fmt.Errorf("%s: %s %w\n", errElastic, err.Error(),
+			errSetting)
+	}
+
+	// get environment overrides for the gelf sub config
+	gelfConfig := new(GELFConfiguration)
+	err = FillConfiguration(config.GELFCfg, gelfConfig, EnvConfig, "",
+		GELFEnvPrefix)
+	if err == nil {
+		config.GELFCfg = *gelfConfig
+	} else {
+		if config.EnableGELF {
+			errSetting = ErrFatal
+		}
+		return cfg, fmt.Errorf("%s: %s %w\n", errGELF, err.Error(),
+			errSetting)
+	}
+
+	// get environment overrides for the otlp sub config
+	otlpConfig := new(OTLPConfiguration)
+	err = FillConfiguration(config.OTLPCfg, otlpConfig, EnvConfig, "",
+		OTLPEnvPrefix)
+	if err == nil {
+		config.OTLPCfg = *otlpConfig
+	} else {
+		if config.EnableOTLP {
+			errSetting = ErrFatal
+		}
+		return cfg, fmt.Errorf("%s: %s %w\n", errOTLP, err.Error(),
+			errSetting)
+	}
 	return *config, nil
 }
 
@@ -284,10 +513,7 @@ func FillConfiguration(defaultCfg interface{}, config interface{},
 	}
 
 	if cfgType == FileConfig || cfgType == BothConfig {
-		v.SetConfigName(filename)
-		v.AddConfigPath(".")
-		v.AddConfigPath("$HOME")
-		v.AddConfigPath("$HOME/.pavedroad.d")
+		addConfigPaths(v, filename)
 		if err := v.ReadInConfig(); err != nil {
 			return err
 		}
@@ -299,6 +525,14 @@ func FillConfiguration(defaultCfg interface{}, config interface{},
 	return nil
 }
 
+// addConfigPaths sets the config file name and the directories searched
+func addConfigPaths(v *viper.Viper, filename string) {
+	v.SetConfigName(filename)
+	v.AddConfigPath(".")
+	v.AddConfigPath("$HOME")
+	v.AddConfigPath("$HOME/.pavedroad.d")
+}
+
 func ExportConfiguration(file string, config LoggerConfiguration) error {
 
 	ybytes, err := yaml.Marshal(config)
@@ -318,25 +552,30 @@ func ExportConfiguration(file string, config LoggerConfiguration) error {
 }
 
 var globalLoggerConfiguration LoggerConfiguration
+var signalOnce sync.Once
 
 func signalCatcher() {
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGUSR1)
-	<-ch
-	ExportConfiguration(ExportConfigFileName, globalLoggerConfiguration)
-	go signalCatcher()
+	for range ch {
+		ExportConfiguration(ExportConfigFileName, globalLoggerConfiguration)
+	}
 }
 
 func checkConfig(config LoggerConfiguration) error {
 	var errCount int
 
-	globalLoggerConfiguration = config
-	go signalCatcher()
+	signalOnce.Do(func() {
+		go signalCatcher()
+	})
 	if config.EnableDebug {
 		ExportConfiguration("", config)
 	}
 
 	checkLoggerConfig(config, &errCount)
+	if config.LogPackage == SlogType {
+		checkSlogConfig(config, &errCount)
+	}
 
 	if config.EnableKafka {
 		checkProducerConfig(config.KafkaProducerCfg, &errCount)
@@ -347,11 +586,31 @@ func checkConfig(config LoggerConfiguration) error {
 	if config.EnableRotation {
 		checkRotationConfig(config.RotationCfg, &errCount)
 	}
+	if config.EnableSyslog {
+		checkSyslogConfig(config.SyslogCfg, &errCount)
+	}
+	if config.EnableHTTP {
+		checkHTTPConfig(config.HTTPCfg, &errCount)
+	}
+	if config.EnableLoki {
+		checkLokiConfig(config.LokiCfg, &errCount)
+	}
+	if config.EnableElastic {
+		checkElasticConfig(config.ElasticCfg, &errCount)
+	}
+	if config.EnableGELF {
+		checkGELFConfig(config.GELFCfg, &errCount)
+	}
+	if config.EnableOTLP {
+		checkOTLPConfig(config.OTLPCfg, &errCount)
+	}
 
 	if errCount > 0 {
 		return errors.New("Invalid configuration")
 	}
 
+	// only a valid configuration is exported on SIGUSR1
+	globalLoggerConfiguration = config
 	return nil
 }
 
@@ -363,12 +622,69 @@ func checkLoggerConfig(lc LoggerConfiguration, errCount *int) {
 		fmt.Fprintf(os.Stderr, "CEFormat requires EnableCloudEvents\n")
 		*errCount++
 	}
+
+	if ((lc.EnableHTTP && lc.HTTPFormat == CEFormat) ||
+		(lc.EnableLoki && lc.LokiFormat == CEFormat)) && !lc.EnableCloudEvents {
+		fmt.Fprintf(os.Stderr, "CEFormat requires EnableCloudEvents\n")
+		*errCount++
+	}
+
+	if lc.GELFCfg.EnableID && !lc.EnableCloudEvents {
+		fmt.Fprintf(os.Stderr, "GELF EnableID requires EnableCloudEvents\n")
+		*errCount++
+	}
+
+	if lc.EnableKafka && lc.EnableCloudEvents &&
+		lc.CloudEventsCfg.Mode == CEBinary && lc.KafkaFormat != CEFormat {
+		fmt.Fprintf(os.Stderr, "CEBinary requires CEFormat for KafkaFormat\n")
+		*errCount++
+	}
+
+	if lc.EnableKafka && lc.KafkaProducerCfg.Fallback == FallbackFile &&
+		!lc.EnableFile {
+		fmt.Fprintf(os.Stderr, "FallbackFile requires EnableFile\n")
+		*errCount++
+	}
+}
+
+// checkSlogConfig validates the sinks and formats the slog package supports
+func checkSlogConfig(lc LoggerConfiguration, errCount *int) {
+	if lc.EnableSyslog || lc.EnableHTTP || lc.EnableLoki ||
+		lc.EnableElastic || lc.EnableGELF || lc.EnableOTLP {
+		fmt.Fprintf(os.Stderr,
+			"SlogType supports console, file and kafka sinks only\n")
+		*errCount++
+	}
+
+	for _, sink := range []struct {
+		name   string
+		format FormatType
+	}{
+		{"ConsoleFormat", lc.ConsoleFormat},
+		{"FileFormat", lc.FileFormat},
+		{"KafkaFormat", lc.KafkaFormat},
+	} {
+		switch sink.format {
+		case JSONFormat:
+		case TextFormat:
+		case CEFormat:
+		case "":
+		default:
+			fmt.Fprintf(os.Stderr, "SlogType does not support %s type: %s\n",
+				sink.name, sink.format)
+			*errCount++
+		}
+	}
 }
 
 func checkProducerConfig(pc ProducerConfiguration, errCount *int) {
 	checkProducerTypes(pc, errCount)
 	if pc.EnableTLS && pc.TLSCfg == nil {
-		fmt.Fprintf(os.Stderr, "Producer missing TLS config\n")
+		checkTLSFiles(pc, errCount)
+	}
+	if pc.EnableSASL && (pc.SASLUsername == "" || pc.SASLPassword == "") {
+		fmt.Fprintf(os.Stderr, "Producer SASL requires SASLUsername and "+
+			"SASLPassword\n")
 		*errCount++
 	}
 	if pc.ProdFlushFreq < 0 {
@@ -391,6 +707,76 @@ func checkProducerConfig(pc ProducerConfiguration, errCount *int) {
 		fmt.Fprintf(os.Stderr, "Producer MetaRetryFreq less than zero\n")
 		*errCount++
 	}
+	if pc.EnableSpool {
+		checkSpoolConfig(pc.SpoolCfg, errCount)
+	}
+	for i, route := range pc.Routes {
+		checkRouteConfig(i, route, errCount)
+	}
+	headers := make(map[string]bool)
+	for _, name := range pc.HeaderFields {
+		if name == "" || headers[name] {
+			fmt.Fprintf(os.Stderr, "Producer HeaderFields empty or "+
+				"duplicate: %q\n", name)
+			*errCount++
+		}
+		headers[name] = true
+	}
+}
+
+// checkRouteConfig validates a kafka routing rule
+func checkRouteConfig(index int, rc RouteConfiguration, errCount *int) {
+	name := fmt.Sprintf("Routes[%d]", index)
+	for _, level := range rc.Levels {
+		checkLevelType(name+" Levels", level, errCount)
+	}
+	checkKeyType(name+" Key", rc.Key, errCount)
+	if rc.Message != "" {
+		if _, err := regexp.Compile(rc.Message); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid %s Message: %s\n", name,
+				err.Error())
+			*errCount++
+		}
+	}
+	if rc.Drop && (rc.Topic != "" || rc.Key != "" || rc.KeyName != "") {
+		fmt.Fprintf(os.Stderr, "%s Drop excludes Topic, Key and KeyName\n",
+			name)
+		*errCount++
+	}
+}
+
+// checkTLSFiles validates the TLS files used if TLSCfg is not set
+func checkTLSFiles(pc ProducerConfiguration, errCount *int) {
+	if (pc.TLSCertFile == "") != (pc.TLSKeyFile == "") {
+		fmt.Fprintf(os.Stderr, "Producer TLSCertFile and TLSKeyFile must be "+
+			"set together\n")
+		*errCount++
+	}
+	for _, file := range []string{pc.TLSCAFile, pc.TLSCertFile,
+		pc.TLSKeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			fmt.Fprintf(os.Stderr, "Producer TLS file: %s\n", err.Error())
+			*errCount++
+		}
+	}
+}
+
+func checkSpoolConfig(sc SpoolConfiguration, errCount *int) {
+	if sc.MaxBytes < 0 {
+		fmt.Fprintf(os.Stderr, "Spool MaxBytes less than zero\n")
+		*errCount++
+	}
+	if sc.MaxAge < 0 {
+		fmt.Fprintf(os.Stderr, "Spool MaxAge less than zero\n")
+		*errCount++
+	}
+	if sc.ReplayFreq < 0 {
+		fmt.Fprintf(os.Stderr, "Spool ReplayFreq less than zero\n")
+		*errCount++
+	}
 }
 
 func checkRotationConfig(rc RotationConfiguration, errCount *int) {
@@ -408,35 +794,235 @@ func checkRotationConfig(rc RotationConfiguration, errCount *int) {
 	}
 }
 
+func checkSyslogConfig(sc SyslogConfiguration, errCount *int) {
+	switch sc.Network {
+	case SyslogUDP:
+	case SyslogTCP:
+	case SyslogTLS:
+	case SyslogUnix:
+	case SyslogUnixgram:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid syslog Network type: %s\n", sc.Network)
+		*errCount++
+	}
+	switch sc.Format {
+	case SyslogRFC5424:
+	case SyslogRFC3164:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid syslog Format type: %s\n", sc.Format)
+		*errCount++
+	}
+	switch sc.Framing {
+	case SyslogOctetCounting:
+	case SyslogNewline:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid syslog Framing type: %s\n", sc.Framing)
+		*errCount++
+	}
+	if _, ok := syslogFacilities[sc.Facility]; !ok && sc.Facility != "" {
+		fmt.Fprintf(os.Stderr, "Invalid syslog Facility: %s\n", sc.Facility)
+		*errCount++
+	}
+	if sc.Network == SyslogTLS && sc.TLSCfg == nil {
+		fmt.Fprintf(os.Stderr, "Syslog missing TLS config\n")
+		*errCount++
+	}
+}
+
+func checkHTTPConfig(hc HTTPConfiguration, errCount *int) {
+	switch hc.Mode {
+	case HTTPBatch:
+	case HTTPStructured:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid http Mode type: %s\n", hc.Mode)
+		*errCount++
+	}
+	if hc.BatchSize < 0 {
+		fmt.Fprintf(os.Stderr, "HTTP BatchSize less than zero\n")
+		*errCount++
+	}
+	if hc.FlushFreq < 0 {
+		fmt.Fprintf(os.Stderr, "HTTP FlushFreq less than zero\n")
+		*errCount++
+	}
+	if hc.QueueSize < 0 {
+		fmt.Fprintf(os.Stderr, "HTTP QueueSize less than zero\n")
+		*errCount++
+	}
+	if hc.Timeout < 0 {
+		fmt.Fprintf(os.Stderr, "HTTP Timeout less than zero\n")
+		*errCount++
+	}
+	if hc.RetryMax < 0 {
+		fmt.Fprintf(os.Stderr, "HTTP RetryMax less than zero\n")
+		*errCount++
+	}
+	if hc.RetryFreq < 0 {
+		fmt.Fprintf(os.Stderr, "HTTP RetryFreq less than zero\n")
+		*errCount++
+	}
+}
+
+func checkLokiConfig(lc LokiConfiguration, errCount *int) {
+	switch lc.Encoding {
+	case LokiProtobuf:
+	case LokiJSON:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid loki Encoding type: %s\n", lc.Encoding)
+		*errCount++
+	}
+	if lc.BatchSize < 0 {
+		fmt.Fprintf(os.Stderr, "Loki BatchSize less than zero\n")
+		*errCount++
+	}
+	if lc.FlushFreq < 0 {
+		fmt.Fprintf(os.Stderr, "Loki FlushFreq less than zero\n")
+		*errCount++
+	}
+	if lc.QueueSize < 0 {
+		fmt.Fprintf(os.Stderr, "Loki QueueSize less than zero\n")
+		*errCount++
+	}
+	if lc.Timeout < 0 {
+		fmt.Fprintf(os.Stderr, "Loki Timeout less than zero\n")
+		*errCount++
+	}
+	if lc.RetryMax < 0 {
+		fmt.Fprintf(os.Stderr, "Loki RetryMax less than zero\n")
+		*errCount++
+	}
+	if lc.RetryFreq < 0 {
+		fmt.Fprintf(os.Stderr, "Loki RetryFreq less than zero\n")
+		*errCount++
+	}
+}
+
+func checkElasticConfig(ec ElasticConfiguration, errCount *int) {
+	if ec.BatchSize < 0 {
+		fmt.Fprintf(os.Stderr, "Elastic BatchSize less than zero\n")
+		*errCount++
+	}
+	if ec.FlushFreq < 0 {
+		fmt.Fprintf(os.Stderr, "Elastic FlushFreq less than zero\n")
+		*errCount++
+	}
+	if ec.QueueSize < 0 {
+		fmt.Fprintf(os.Stderr, "Elastic QueueSize less than zero\n")
+		*errCount++
+	}
+	if ec.Timeout < 0 {
+		fmt.Fprintf(os.Stderr, "Elastic Timeout less than zero\n")
+		*errCount++
+	}
+	if ec.RetryMax < 0 {
+		fmt.Fprintf(os.Stderr, "Elastic RetryMax less than zero\n")
+		*errCount++
+	}
+	if ec.RetryFreq < 0 {
+		fmt.Fprintf(os.Stderr, "Elastic RetryFreq less than zero\n")
+		*errCount++
+	}
+}
+
+func checkGELFConfig(gc GELFConfiguration, errCount *int) {
+	switch gc.Network {
+	case GELFUDP:
+	case GELFTCP:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid gelf Network type: %s\n", gc.Network)
+		*errCount++
+	}
+	switch gc.Compression {
+	case GELFGzip:
+	case GELFZlib:
+	case GELFNone:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid gelf Compression type: %s\n",
+			gc.Compression)
+		*errCount++
+	}
+	if gc.ChunkSize < 0 {
+		fmt.Fprintf(os.Stderr, "GELF ChunkSize less than zero\n")
+		*errCount++
+	} else if gc.ChunkSize > 0 && gc.ChunkSize <= gelfChunkHeaderSize {
+		fmt.Fprintf(os.Stderr, "GELF ChunkSize must be more than %d\n",
+			gelfChunkHeaderSize)
+		*errCount++
+	}
+}
+
+func checkOTLPConfig(oc OTLPConfiguration, errCount *int) {
+	switch oc.Protocol {
+	case OTLPGRPC:
+	case OTLPHTTP:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid otlp Protocol type: %s\n", oc.Protocol)
+		*errCount++
+	}
+	if oc.BatchSize < 0 {
+		fmt.Fprintf(os.Stderr, "OTLP BatchSize less than zero\n")
+		*errCount++
+	}
+	if oc.FlushFreq < 0 {
+		fmt.Fprintf(os.Stderr, "OTLP FlushFreq less than zero\n")
+		*errCount++
+	}
+	if oc.QueueSize < 0 {
+		fmt.Fprintf(os.Stderr, "OTLP QueueSize less than zero\n")
+		*errCount++
+	}
+	if oc.Timeout < 0 {
+		fmt.Fprintf(os.Stderr, "OTLP Timeout less than zero\n")
+		*errCount++
+	}
+	if oc.RetryMax < 0 {
+		fmt.Fprintf(os.Stderr, "OTLP RetryMax less than zero\n")
+		*errCount++
+	}
+	if oc.RetryFreq < 0 {
+		fmt.Fprintf(os.Stderr, "OTLP RetryFreq less than zero\n")
+		*errCount++
+	}
+}
+
 func checkLoggerTypes(lc LoggerConfiguration, errCount *int) {
 	switch lc.LogPackage {
 	case ZapType:
 	case LogrusType:
+	case SlogType:
 	case "":
 	default:
 		fmt.Fprintf(os.Stderr, "Invalid LogPackage type: %s\n", lc.LogPackage)
 		*errCount++
 	}
 
-	switch lc.LogLevel {
-	case DebugType:
-	case InfoType:
-	case WarnType:
-	case ErrorType:
-	case FatalType:
-	case PanicType:
-	case "":
-	default:
-		fmt.Fprintf(os.Stderr, "Invalid LogLevel type: %s\n", lc.LogLevel)
-		*errCount++
-	}
+	checkLevelType("LogLevel", lc.LogLevel, errCount)
+	checkLevelType("ConsoleLevel", lc.ConsoleLevel, errCount)
+	checkLevelType("FileLevel", lc.FileLevel, errCount)
+	checkLevelType("KafkaLevel", lc.KafkaLevel, errCount)
+	checkLevelType("SyslogLevel", lc.SyslogLevel, errCount)
+	checkLevelType("HTTPLevel", lc.HTTPLevel, errCount)
+	checkLevelType("LokiLevel", lc.LokiLevel, errCount)
+	checkLevelType("ElasticLevel", lc.ElasticLevel, errCount)
+	checkLevelType("GELFLevel", lc.GELFLevel, errCount)
+	checkLevelType("OTLPLevel", lc.OTLPLevel, errCount)
 
 	switch lc.ConsoleFormat {
 	case JSONFormat:
+	case LogfmtFormat:
 	case TextFormat:
-	case "":
+	case ECSFormat:
+	case GELFFormat:
 	case CEFormat:
-		fallthrough
+	case "":
 	default:
 		fmt.Fprintf(os.Stderr, "Invalid ConsoleFormat type: %s\n",
 			lc.ConsoleFormat)
@@ -476,14 +1062,95 @@ func checkLoggerTypes(lc LoggerConfiguration, errCount *int) {
 
 	switch lc.FileFormat {
 	case JSONFormat:
+	case LogfmtFormat:
 	case TextFormat:
-	case "":
+	case ECSFormat:
+	case GELFFormat:
 	case CEFormat:
-		fallthrough
+	case "":
 	default:
 		fmt.Fprintf(os.Stderr, "Invalid FileFormat type: %s\n", lc.FileFormat)
 		*errCount++
 	}
+
+	switch lc.LokiFormat {
+	case JSONFormat:
+	case LogfmtFormat:
+	case TextFormat:
+	case ECSFormat:
+	case GELFFormat:
+	case CEFormat:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid LokiFormat type: %s\n", lc.LokiFormat)
+		*errCount++
+	}
+
+	// documents must be JSON objects without cloudevents ids
+	switch lc.ElasticFormat {
+	case JSONFormat:
+	case ECSFormat:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid ElasticFormat type: %s\n",
+			lc.ElasticFormat)
+		*errCount++
+	}
+
+	// records are sent as JSON so text format is not supported
+	switch lc.HTTPFormat {
+	case JSONFormat:
+	case ECSFormat:
+	case GELFFormat:
+	case CEFormat:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid HTTPFormat type: %s\n", lc.HTTPFormat)
+		*errCount++
+	}
+
+	switch lc.ReloadMode {
+	case ReloadNone:
+	case ReloadWatch:
+	case ReloadSignal:
+	case ReloadBoth:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid ReloadMode type: %s\n", lc.ReloadMode)
+		*errCount++
+	}
+}
+
+// checkKeyType validates a kafka key type, empty means the default key
+func checkKeyType(name string, key kafkaKeyType, errCount *int) {
+	switch key {
+	case LevelKey:
+	case TimeSecondKey:
+	case TimeNanoSecondKey:
+	case FixedKey:
+	case ExtractedKey:
+	case FunctionKey:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid %s type: %s\n", name, key)
+		*errCount++
+	}
+}
+
+// checkLevelType validates a level, empty means the default level
+func checkLevelType(name string, level LevelType, errCount *int) {
+	switch level {
+	case DebugType:
+	case InfoType:
+	case WarnType:
+	case ErrorType:
+	case FatalType:
+	case PanicType:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid %s type: %s\n", name, level)
+		*errCount++
+	}
 }
 
 func checkCETypes(cc CloudEventsConfiguration, errCount *int) {
@@ -497,6 +1164,15 @@ func checkCETypes(cc CloudEventsConfiguration, errCount *int) {
 		fmt.Fprintf(os.Stderr, "Invalid SetID type: %s\n", cc.SetID)
 		*errCount++
 	}
+
+	switch cc.Mode {
+	case CEStructured:
+	case CEBinary:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid Mode type: %s\n", cc.Mode)
+		*errCount++
+	}
 }
 
 func checkProducerTypes(pc ProducerConfiguration, errCount *int) {
@@ -510,18 +1186,7 @@ func checkProducerTypes(pc ProducerConfiguration, errCount *int) {
 		*errCount++
 	}
 
-	switch pc.Key {
-	case LevelKey:
-	case TimeSecondKey:
-	case TimeNanoSecondKey:
-	case FixedKey:
-	case ExtractedKey:
-	case FunctionKey:
-	case "":
-	default:
-		fmt.Fprintf(os.Stderr, "Invalid Key type: %s\n", pc.Key)
-		*errCount++
-	}
+	checkKeyType("Key", pc.Key, errCount)
 
 	switch pc.Compression {
 	case CompressionNone:
@@ -544,6 +1209,39 @@ func checkProducerTypes(pc ProducerConfiguration, errCount *int) {
 		fmt.Fprintf(os.Stderr, "Invalid AckWait type: %s\n", pc.AckWait)
 		*errCount++
 	}
+
+	switch pc.Fallback {
+	case FallbackNone:
+	case FallbackConsole:
+	case FallbackFile:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid Fallback type: %s\n", pc.Fallback)
+		*errCount++
+	}
+
+	switch pc.TLSMinVersion {
+	case TLSVersion10:
+	case TLSVersion11:
+	case TLSVersion12:
+	case TLSVersion13:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid TLSMinVersion type: %s\n",
+			pc.TLSMinVersion)
+		*errCount++
+	}
+
+	switch pc.SASLMechanism {
+	case SASLPlain:
+	case SASLSCRAMSHA256:
+	case SASLSCRAMSHA512:
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid SASLMechanism type: %s\n",
+			pc.SASLMechanism)
+		*errCount++
+	}
 }
 
 // Print emulates function from go log pkg
@@ -734,3 +1432,92 @@ func Panicln(args ...interface{}) {
 	}
 	logger.Panic(strings.TrimRight(fmt.Sprintln(args...), "\n"))
 }
+
+// Debugw logs a message with alternating keys and values as fields
+func Debugw(msg string, keysAndValues ...interface{}) {
+	if logger == nil {
+		fmt.Fprintf(os.Stderr, "Logger not initialized\n")
+		return
+	}
+	logger.Debugw(msg, keysAndValues...)
+}
+
+// Infow logs a message with alternating keys and values as fields
+func Infow(msg string, keysAndValues ...interface{}) {
+	if logger == nil {
+		fmt.Fprintf(os.Stderr, "Logger not initialized\n")
+		return
+	}
+	logger.Infow(msg, keysAndValues...)
+}
+
+// Warnw logs a message with alternating keys and values as fields
+func Warnw(msg string, keysAndValues ...interface{}) {
+	if logger == nil {
+		fmt.Fprintf(os.Stderr, "Logger not initialized\n")
+		return
+	}
+	logger.Warnw(msg, keysAndValues...)
+}
+
+// Errorw logs a message with alternating keys and values as fields
+func Errorw(msg string, keysAndValues ...interface{}) {
+	if logger == nil {
+		fmt.Fprintf(os.Stderr, "Logger not initialized\n")
+		return
+	}
+	logger.Errorw(msg, keysAndValues...)
+}
+
+// Fatalw logs a message with alternating keys and values as fields
+func Fatalw(msg string, keysAndValues ...interface{}) {
+	if logger == nil {
+		fmt.Fprintf(os.Stderr, "Logger not initialized\n")
+		return
+	}
+	logger.Fatalw(msg, keysAndValues...)
+}
+
+// Panicw logs a message with alternating keys and values as fields
+func Panicw(msg string, keysAndValues ...interface{}) {
+	if logger == nil {
+		fmt.Fprintf(os.Stderr, "Logger not initialized\n")
+		return
+	}
+	logger.Panicw(msg, keysAndValues...)
+}
+
+// SetLevel changes the log level of the global logger
+func SetLevel(level LevelType) {
+	if logger == nil {
+		fmt.Fprintf(os.Stderr, "Logger not initialized\n")
+		return
+	}
+	logger.SetLevel(level)
+}
+
+// GetLevel returns the log level of the global logger
+func GetLevel() LevelType {
+	if logger == nil {
+		fmt.Fprintf(os.Stderr, "Logger not initialized\n")
+		return ""
+	}
+	return logger.GetLevel()
+}
+
+// Sync flushes all sinks of the global logger
+func Sync() error {
+	if logger == nil {
+		return errors.New("Logger not initialized")
+	}
+	return logger.Sync()
+}
+
+// Close flushes and releases all sinks of the global logger
+// Kafka messages still in flight are drained until ctx is done
+func Close(ctx context.Context) error {
+	if logger == nil {
+		return errors.New("Logger not initialized")
+	}
+	return logger.Close(ctx)
+}
@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"context"
+	"sync"
+)
+
+// ContextExtractor func returns fields to log from a request context
+type ContextExtractor func(ctx context.Context) LogFields
+
+// contextKey provides the type for storing a logger in a context
+type contextKey struct{}
+
+// contextExtractors holds the registered extractors in registration order
+// trace correlation fields are always extracted
+var contextExtractors = struct {
+	sync.RWMutex
+	extractors []ContextExtractor
+}{
+	extractors: []ContextExtractor{TraceFields},
+}
+
+// RegisterContextExtractor adds an extractor used by WithContext
+// fields from later extractors replace fields with the same name
+func RegisterContextExtractor(extractor ContextExtractor) {
+	contextExtractors.Lock()
+	defer contextExtractors.Unlock()
+	contextExtractors.extractors = append(contextExtractors.extractors,
+		extractor)
+}
+
+// ContextFields returns the fields of all registered extractors for ctx
+func ContextFields(ctx context.Context) LogFields {
+	contextExtractors.RLock()
+	defer contextExtractors.RUnlock()
+
+	fields := LogFields{}
+	for _, extractor := range contextExtractors.extractors {
+		for key, value := range extractor(ctx) {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// withContext adds the context fields to log, if there are any
+func withContext(log Logger, ctx context.Context) Logger {
+	fields := ContextFields(ctx)
+	if len(fields) == 0 {
+		return log
+	}
+	return log.WithFields(fields)
+}
+
+// NewContext returns a copy of ctx that carries log
+func NewContext(ctx context.Context, log Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, log)
+}
+
+// FromContext returns the logger carried by ctx or else the global logger
+// with the context fields added, returns nil if neither logger exists
+func FromContext(ctx context.Context) Logger {
+	log, ok := ctx.Value(contextKey{}).(Logger)
+	if !ok {
+		log = logger
+	}
+	if log == nil {
+		return nil
+	}
+	return log.WithContext(ctx)
+}
@@ -0,0 +1,152 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Keys for elastic common schema fields
+const (
+	ECSTimestampKey    = "@timestamp"
+	ECSLevelKey        = "log.level"
+	ECSMessageKey      = "message"
+	ECSServiceNameKey  = "service.name"
+	ECSErrorMessageKey = "error.message"
+	ECSErrorTypeKey    = "error.type"
+	ECSVersionKey      = "ecs.version"
+)
+
+// ECSVersion is the elastic common schema version of ECS records
+const ECSVersion = "8.11.0"
+
+// ecsErrorKey is the key of error fields mapped to error.*
+const ecsErrorKey = "error"
+
+// getServiceName returns the configured service name or the program name
+func getServiceName(config LoggerConfiguration) string {
+	if config.ServiceName != "" {
+		return config.ServiceName
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// ecsEncoder provides wrapper for the JSONEncoder (to map ECS fields)
+type ecsEncoder struct {
+	zapcore.Encoder
+	fields []zapcore.Field
+}
+
+// newECSEncoder returns an ECS encoder
+// the timestamp is always added since ECS requires it
+func newECSEncoder(config LoggerConfiguration) zapcore.Encoder {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = ECSTimestampKey
+	encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	encoderConfig.LevelKey = ECSLevelKey
+	encoderConfig.MessageKey = ECSMessageKey
+	encoderConfig.NameKey = zapcore.OmitKey
+	encoderConfig.CallerKey = zapcore.OmitKey
+	encoderConfig.StacktraceKey = zapcore.OmitKey
+
+	return &ecsEncoder{
+		zapcore.NewJSONEncoder(encoderConfig),
+		[]zapcore.Field{
+			zap.String(ECSServiceNameKey, getServiceName(config)),
+			zap.String(ECSVersionKey, ECSVersion),
+		},
+	}
+}
+
+// Clone meets the interface for the zapcore encoder
+func (ecs *ecsEncoder) Clone() zapcore.Encoder {
+	return &ecsEncoder{
+		ecs.Encoder.Clone(),
+		ecs.fields,
+	}
+}
+
+// AddString meets the interface for the zapcore encoder
+// error fields added by WithFields become error.message
+func (ecs *ecsEncoder) AddString(key, value string) {
+	if key == ecsErrorKey {
+		key = ECSErrorMessageKey
+	}
+	ecs.Encoder.AddString(key, value)
+}
+
+// EncodeEntry meets the interface for the zapcore encoder
+func (ecs *ecsEncoder) EncodeEntry(entry zapcore.Entry,
+	fields []zapcore.Field) (*buffer.Buffer, error) {
+	ecsFields := make([]zapcore.Field, 0, len(fields)+len(ecs.fields)+1)
+	for _, field := range fields {
+		if field.Key != ecsErrorKey {
+			ecsFields = append(ecsFields, field)
+			continue
+		}
+		switch field.Type {
+		case zapcore.ErrorType:
+			err := field.Interface.(error)
+			ecsFields = append(ecsFields,
+				zap.String(ECSErrorMessageKey, err.Error()),
+				zap.String(ECSErrorTypeKey, fmt.Sprintf("%T", err)))
+		case zapcore.StringType:
+			ecsFields = append(ecsFields,
+				zap.String(ECSErrorMessageKey, field.String))
+		default:
+			ecsFields = append(ecsFields, field)
+		}
+	}
+	// ECS fields are added here, not by using WithFields
+	ecsFields = append(ecsFields, ecs.fields...)
+	return ecs.Encoder.EncodeEntry(entry, ecsFields)
+}
+
+// ecsFormatter provides wrapper for the JSONFormatter (to map ECS fields)
+type ecsFormatter struct {
+	logrus.JSONFormatter
+	fields logrus.Fields
+}
+
+// newECSFormatter returns an ECS formatter
+// the timestamp is always added since ECS requires it
+func newECSFormatter(config LoggerConfiguration) logrus.Formatter {
+	return &ecsFormatter{
+		logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339Nano,
+			FieldMap: logrus.FieldMap{
+				logrus.FieldKeyTime:  ECSTimestampKey,
+				logrus.FieldKeyLevel: ECSLevelKey,
+				logrus.FieldKeyMsg:   ECSMessageKey,
+			},
+		},
+		logrus.Fields{
+			ECSServiceNameKey: getServiceName(config),
+			ECSVersionKey:     ECSVersion,
+		},
+	}
+}
+
+// Format meets the interface for the logrus formatter
+func (ecs *ecsFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	// ECS fields are added to a copy of entry like CE fields
+	ecsEntry := entry.WithFields(ecs.fields)
+	if value, ok := ecsEntry.Data[ecsErrorKey]; ok {
+		delete(ecsEntry.Data, ecsErrorKey)
+		if err, ok := value.(error); ok {
+			ecsEntry.Data[ECSErrorMessageKey] = err.Error()
+			ecsEntry.Data[ECSErrorTypeKey] = fmt.Sprintf("%T", err)
+		} else {
+			ecsEntry.Data[ECSErrorMessageKey] = fmt.Sprint(value)
+		}
+	}
+	ecsEntry.Level = entry.Level
+	ecsEntry.Message = entry.Message
+	return ecs.JSONFormatter.Format(ecsEntry)
+}
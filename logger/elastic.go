@@ -0,0 +1,240 @@
+package logger
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// elasticContentType is the content type of bulk requests
+const elasticContentType = "application/x-ndjson"
+
+// ElasticConfiguration provides elasticsearch/opensearch sink configuration
+type ElasticConfiguration struct {
+	URL          string // cluster URL, /_bulk is appended
+	Index        string // index name template, see indexTemplate
+	APIKey       string // sent as ApiKey authorization if set
+	Username     string // basic auth, ignored if APIKey set
+	Password     string
+	Headers      map[string]string
+	BatchSize    int           // records sent when the batch is full
+	FlushFreq    time.Duration // or when the batch is this old
+	QueueSize    int           // batches waiting to be sent
+	Timeout      time.Duration // per request
+	RetryMax     int           // retries for 429 and 5xx responses
+	RetryFreq    time.Duration // first backoff, doubled for each retry
+	TLSCfg       *tls.Config   `json:"-" yaml:"-"`
+	ErrorHandler ErrorFunc     `json:"-" yaml:"-"` // called with URL and body
+}
+
+// getElasticFormat returns the format of the elasticsearch sink, ecs if not set
+func getElasticFormat(format FormatType) FormatType {
+	if format == "" {
+		return ECSFormat
+	}
+	return format
+}
+
+// indexPart provides a literal, field or time part of an index template
+type indexPart struct {
+	literal string
+	key     string // %{key} is replaced by the field value
+	layout  string // %{+layout} is replaced by the record time in UTC
+}
+
+// indexTemplate provides a parsed index name template
+// %{service} and %{level} are the service name and level of the record
+// other %{key} are the value of the field key, empty if not set
+// %{+layout} is the record time formatted with the go time layout
+// Example: logs-%{service}-%{+2006.01.02}
+type indexTemplate []indexPart
+
+// parseIndexTemplate returns the parts of an index name template
+func parseIndexTemplate(template string) indexTemplate {
+	var parts indexTemplate
+	for template != "" {
+		start := strings.Index(template, "%{")
+		end := -1
+		if start >= 0 {
+			end = strings.Index(template[start:], "}") + start
+		}
+		if end <= start {
+			// no more complete %{...}
+			parts = append(parts, indexPart{literal: template})
+			break
+		}
+		if start > 0 {
+			parts = append(parts, indexPart{literal: template[:start]})
+		}
+		name := template[start+2 : end]
+		if strings.HasPrefix(name, "+") {
+			parts = append(parts, indexPart{layout: name[1:]})
+		} else {
+			parts = append(parts, indexPart{key: name})
+		}
+		template = template[end+1:]
+	}
+	return parts
+}
+
+// keys returns the field keys the template uses
+func (it indexTemplate) keys() []string {
+	var keys []string
+	for _, part := range it {
+		if part.key != "" {
+			keys = append(keys, part.key)
+		}
+	}
+	return keys
+}
+
+// name returns the index name for a record, index names are lower case
+func (it indexTemplate) name(service string, level LevelType, t time.Time,
+	fields map[string]interface{}) string {
+
+	var b strings.Builder
+	for _, part := range it {
+		switch {
+		case part.layout != "":
+			b.WriteString(t.UTC().Format(part.layout))
+		case part.key == "service":
+			b.WriteString(service)
+		case part.key == "level":
+			b.WriteString(string(level))
+		case part.key != "":
+			if value, ok := fields[part.key]; ok {
+				b.WriteString(fmt.Sprint(value))
+			}
+		default:
+			b.WriteString(part.literal)
+		}
+	}
+	return strings.ToLower(b.String())
+}
+
+// elasticWriter sends records to the bulk API of elasticsearch or opensearch
+type elasticWriter struct {
+	*httpWriter
+	index   indexTemplate
+	service string
+}
+
+// bulkReply provides the parts of a bulk response used to find failures
+type bulkReply struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// newElasticWriter returns an elasticsearch writer instance
+func newElasticWriter(config ElasticConfiguration,
+	service string) *elasticWriter {
+
+	url := config.URL
+	if url == "" {
+		url = defaultElasticConfiguration.URL
+	}
+	template := config.Index
+	if template == "" {
+		template = defaultElasticConfiguration.Index
+	}
+
+	headers := make(map[string]string)
+	for key, value := range config.Headers {
+		headers[key] = value
+	}
+	username := config.Username
+	if config.APIKey != "" {
+		headers["Authorization"] = "ApiKey " + config.APIKey
+		username = ""
+	}
+
+	ew := &elasticWriter{
+		index:   parseIndexTemplate(template),
+		service: service,
+	}
+	ew.httpWriter = newBatchWriter(HTTPConfiguration{
+		URL:          strings.TrimRight(url, "/") + "/_bulk",
+		Headers:      headers,
+		Username:     username,
+		Password:     config.Password,
+		BatchSize:    config.BatchSize,
+		FlushFreq:    config.FlushFreq,
+		QueueSize:    config.QueueSize,
+		Timeout:      config.Timeout,
+		RetryMax:     config.RetryMax,
+		RetryFreq:    config.RetryFreq,
+		TLSCfg:       config.TLSCfg,
+		ErrorHandler: config.ErrorHandler,
+	}, elasticContentType, elasticEncode)
+	ew.check = elasticCheck
+	return ew
+}
+
+// write adds a record for the index of its service, level, time and fields
+func (ew *elasticWriter) write(level LevelType, t time.Time, line []byte,
+	fields map[string]interface{}) error {
+
+	// encoders reuse their buffers so the line is copied
+	line = append([]byte(nil), bytes.TrimRight(line, "\n")...)
+	return ew.add(httpRecord{
+		line:  line,
+		time:  t,
+		index: ew.index.name(ew.service, level, t, fields),
+	})
+}
+
+// elasticEncode returns the bulk request for a batch
+// each record is created in its index, data streams only accept create
+func elasticEncode(batch []httpRecord) ([]httpBody, error) {
+	var body bytes.Buffer
+	for _, record := range batch {
+		action, err := json.Marshal(map[string]interface{}{
+			"create": map[string]string{"_index": record.index},
+		})
+		if err != nil {
+			return nil, err
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(record.line)
+		body.WriteByte('\n')
+	}
+	return []httpBody{{body.Bytes(), len(batch)}}, nil
+}
+
+// elasticCheck returns the number of records the bulk response rejected
+// a bulk request succeeds even if some or all of its records fail
+func elasticCheck(reply []byte) (int, error) {
+	var bulk bulkReply
+	if err := json.Unmarshal(reply, &bulk); err != nil {
+		return 0, fmt.Errorf("Elasticsearch bulk response: %w", err)
+	}
+	if !bulk.Errors {
+		return 0, nil
+	}
+
+	var rejected int
+	var reason string
+	for _, item := range bulk.Items {
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			if rejected == 0 {
+				reason = result.Error.Type + ": " + result.Error.Reason
+			}
+			rejected++
+		}
+	}
+	return rejected, fmt.Errorf("Elasticsearch bulk rejected %d of %d: %s",
+		rejected, len(bulk.Items), reason)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	log "github.com/pavedroad-io/go-core/logger"
@@ -14,5 +16,10 @@ func main() {
 	log.Printf("Logging using env config: %s", "Printf")
 	log.Print("Logging using env config:", "Print")
 	log.Println("Logging using env config:", "Println")
-	time.Sleep(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := log.Close(ctx); err != nil {
+		fmt.Printf("Could not close logger: %s\n", err.Error())
+	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os/user"
 	"time"
@@ -9,8 +10,8 @@ import (
 )
 
 // Create loggers for zap and logrus
-// Note that Kafka producer flush frequency is set to one half second
-// Thus the one second sleeps below will cause the queue to be flushed
+// Each logger is closed before the next is created
+// Closing waits for the Kafka producer queue to be flushed
 
 func main() {
 	user, _ := user.Current()
@@ -57,7 +58,7 @@ func main() {
 		log.Printf("Zap using %s", "Printf")
 		log.Print("Zap using", "Print")
 		log.Println("Zap using", "Println")
-		time.Sleep(time.Second)
+		closeLogger(log)
 	}
 
 	// try a logrus logger
@@ -77,7 +78,7 @@ func main() {
 		log.Printf("Logrus using %s", "Printf")
 		log.Print("Logrus using", "Print")
 		log.Println("Logrus using", "Println")
-		time.Sleep(time.Second)
+		closeLogger(log)
 	}
 
 	// try setting key to message subject field value
@@ -89,7 +90,7 @@ func main() {
 		fmt.Printf("Could not instantiate logrus logger: %s\n", err.Error())
 	} else {
 		log.Infof("Logrus using Infof and subject key (level)")
-		time.Sleep(time.Second)
+		closeLogger(log)
 	}
 
 	// try setting key to current time in seconds
@@ -100,7 +101,7 @@ func main() {
 		fmt.Printf("Could not instantiate logrus logger: %s\n", err.Error())
 	} else {
 		log.Infof("Logrus using Infof and seconds key")
-		time.Sleep(time.Second)
+		closeLogger(log)
 	}
 
 	// try setting key to current time in nanoseconds
@@ -111,6 +112,15 @@ func main() {
 		fmt.Printf("Could not instantiate logrus logger: %s\n", err.Error())
 	} else {
 		log.Infof("Logrus using Infof and nanoseconds key")
-		time.Sleep(time.Second)
+		closeLogger(log)
+	}
+}
+
+// closeLogger drains the Kafka producer allowing up to five seconds
+func closeLogger(log logger.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := log.Close(ctx); err != nil {
+		fmt.Printf("Could not close logger: %s\n", err.Error())
 	}
 }
@@ -0,0 +1,454 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// gelfNetworkType provides gelf transport type
+type gelfNetworkType string
+
+// Supported gelf transports
+const (
+	GELFUDP gelfNetworkType = "udp" // default - chunked and compressed
+	GELFTCP gelfNetworkType = "tcp" // null byte framed, not compressed
+)
+
+// gelfCompressionType provides gelf udp compression type
+type gelfCompressionType string
+
+// Supported gelf udp compression
+const (
+	GELFGzip gelfCompressionType = "gzip" // default
+	GELFZlib gelfCompressionType = "zlib"
+	GELFNone gelfCompressionType = "none"
+)
+
+// Keys for gelf fields
+const (
+	GELFVersionKey      = "version"
+	GELFHostKey         = "host"
+	GELFShortMessageKey = "short_message"
+	GELFTimestampKey    = "timestamp"
+	GELFLevelKey        = "level"
+	GELFMessageIDKey    = "_message_id" // cloudevents id or id field
+)
+
+// GELFVersion is the gelf specification version of gelf records
+const GELFVersion = "1.1"
+
+// Limits of chunked gelf udp messages
+const (
+	gelfChunkHeaderSize = 12 // magic, message id, sequence number and count
+	gelfMaxChunks       = 128
+)
+
+// gelfChunkMagic starts each chunk of a chunked gelf message
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// GELFConfiguration provides gelf format and sink configuration type
+type GELFConfiguration struct {
+	Network     gelfNetworkType
+	Address     string // host:port
+	Host        string // host field, defaults to the host name
+	Compression gelfCompressionType
+	ChunkSize   int  // max udp datagram size, larger messages are chunked
+	EnableID    bool // add the cloudevents id, requires EnableCloudEvents
+}
+
+// getGELFHost returns the configured host field or the host name
+func getGELFHost(config GELFConfiguration) string {
+	if config.Host != "" {
+		return config.Host
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// gelfFieldName returns the additional field name for a field key
+// the id field is sent as _message_id since gelf reserves _id
+func gelfFieldName(key string) string {
+	if key == CEIDKey {
+		return GELFMessageIDKey
+	}
+	return "_" + strings.Map(func(r rune) rune {
+		if r == '_' || r == '.' || r == '-' || (r >= 'a' && r <= 'z') ||
+			(r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// gelfLevelEncoder encodes the level as a syslog severity
+func gelfLevelEncoder(level zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendInt(getSyslogSeverity(getLevelType(level)))
+}
+
+// gelfEncoder provides wrapper for the JSONEncoder (to map gelf fields)
+// fields become additional fields with names prefixed by _
+type gelfEncoder struct {
+	zapcore.Encoder
+	fields []zapcore.Field
+}
+
+// newGELFEncoder returns a gelf encoder
+// the timestamp is always added as seconds since the epoch
+func newGELFEncoder(config LoggerConfiguration) zapcore.Encoder {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = GELFTimestampKey
+	encoderConfig.EncodeTime = zapcore.EpochTimeEncoder
+	encoderConfig.LevelKey = GELFLevelKey
+	encoderConfig.EncodeLevel = gelfLevelEncoder
+	encoderConfig.MessageKey = GELFShortMessageKey
+	encoderConfig.NameKey = zapcore.OmitKey
+	encoderConfig.CallerKey = zapcore.OmitKey
+	encoderConfig.StacktraceKey = zapcore.OmitKey
+
+	return &gelfEncoder{
+		zapcore.NewJSONEncoder(encoderConfig),
+		[]zapcore.Field{
+			zap.String(GELFVersionKey, GELFVersion),
+			zap.String(GELFHostKey, getGELFHost(config.GELFCfg)),
+		},
+	}
+}
+
+// Clone meets the interface for the zapcore encoder
+func (ge *gelfEncoder) Clone() zapcore.Encoder {
+	return &gelfEncoder{
+		ge.Encoder.Clone(),
+		ge.fields,
+	}
+}
+
+// EncodeEntry meets the interface for the zapcore encoder
+func (ge *gelfEncoder) EncodeEntry(entry zapcore.Entry,
+	fields []zapcore.Field) (*buffer.Buffer, error) {
+	gelfFields := make([]zapcore.Field, 0, len(fields)+len(ge.fields))
+	for _, field := range fields {
+		field.Key = gelfFieldName(field.Key)
+		gelfFields = append(gelfFields, field)
+	}
+	// gelf fields are added here, not by using WithFields
+	gelfFields = append(gelfFields, ge.fields...)
+	return ge.Encoder.EncodeEntry(entry, gelfFields)
+}
+
+// The following methods add fields from WithFields as additional fields
+
+func (ge *gelfEncoder) AddArray(key string,
+	arr zapcore.ArrayMarshaler) error {
+	return ge.Encoder.AddArray(gelfFieldName(key), arr)
+}
+
+func (ge *gelfEncoder) AddObject(key string,
+	obj zapcore.ObjectMarshaler) error {
+	return ge.Encoder.AddObject(gelfFieldName(key), obj)
+}
+
+func (ge *gelfEncoder) AddBinary(key string, value []byte) {
+	ge.Encoder.AddBinary(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddByteString(key string, value []byte) {
+	ge.Encoder.AddByteString(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddBool(key string, value bool) {
+	ge.Encoder.AddBool(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddComplex128(key string, value complex128) {
+	ge.Encoder.AddComplex128(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddComplex64(key string, value complex64) {
+	ge.Encoder.AddComplex64(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddDuration(key string, value time.Duration) {
+	ge.Encoder.AddDuration(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddFloat64(key string, value float64) {
+	ge.Encoder.AddFloat64(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddFloat32(key string, value float32) {
+	ge.Encoder.AddFloat32(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddInt(key string, value int) {
+	ge.Encoder.AddInt(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddInt64(key string, value int64) {
+	ge.Encoder.AddInt64(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddInt32(key string, value int32) {
+	ge.Encoder.AddInt32(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddInt16(key string, value int16) {
+	ge.Encoder.AddInt16(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddInt8(key string, value int8) {
+	ge.Encoder.AddInt8(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddString(key, value string) {
+	ge.Encoder.AddString(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddTime(key string, value time.Time) {
+	ge.Encoder.AddTime(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddUint(key string, value uint) {
+	ge.Encoder.AddUint(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddUint64(key string, value uint64) {
+	ge.Encoder.AddUint64(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddUint32(key string, value uint32) {
+	ge.Encoder.AddUint32(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddUint16(key string, value uint16) {
+	ge.Encoder.AddUint16(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddUint8(key string, value uint8) {
+	ge.Encoder.AddUint8(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddUintptr(key string, value uintptr) {
+	ge.Encoder.AddUintptr(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) AddReflected(key string, value interface{}) error {
+	return ge.Encoder.AddReflected(gelfFieldName(key), value)
+}
+
+func (ge *gelfEncoder) OpenNamespace(key string) {
+	ge.Encoder.OpenNamespace(gelfFieldName(key))
+}
+
+// gelfFormatter provides a logrus formatter for gelf records
+type gelfFormatter struct {
+	host string
+}
+
+// newGELFFormatter returns a gelf formatter
+func newGELFFormatter(config LoggerConfiguration) logrus.Formatter {
+	return &gelfFormatter{host: getGELFHost(config.GELFCfg)}
+}
+
+// Format meets the interface for the logrus formatter
+func (gf *gelfFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data)+6)
+	for key, value := range entry.Data {
+		if err, ok := value.(error); ok {
+			// errors are not marshaled by encoding/json
+			value = err.Error()
+		}
+		data[gelfFieldName(key)] = value
+	}
+	if entry.Context != nil {
+		if id, ok := entry.Context.Value(ceIDKey{}).(string); ok {
+			data[GELFMessageIDKey] = id
+		}
+	}
+	data[GELFVersionKey] = GELFVersion
+	data[GELFHostKey] = gf.host
+	data[GELFShortMessageKey] = entry.Message
+	data[GELFTimestampKey] = float64(entry.Time.UnixNano()) / 1e9
+	data[GELFLevelKey] = getSyslogSeverity(getLogrusLevelType(entry.Level))
+
+	msg, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal gelf fields: %w", err)
+	}
+	return append(msg, '\n'), nil
+}
+
+// gelfWriter is a zap WriteSyncer (io.Writer) that sends gelf records
+type gelfWriter struct {
+	config GELFConfiguration
+	mut    sync.Mutex
+	conn   net.Conn
+}
+
+// newGELFWriter returns a gelf writer connected to the server
+func newGELFWriter(config GELFConfiguration) (*gelfWriter, error) {
+	gw := gelfWriter{config: config}
+	if config.Network == "" {
+		gw.config.Network = defaultGELFConfiguration.Network
+	}
+	if config.Address == "" {
+		gw.config.Address = defaultGELFConfiguration.Address
+	}
+	if config.Compression == "" {
+		gw.config.Compression = defaultGELFConfiguration.Compression
+	}
+	if config.ChunkSize == 0 {
+		gw.config.ChunkSize = defaultGELFConfiguration.ChunkSize
+	}
+
+	conn, err := net.Dial(string(gw.config.Network), gw.config.Address)
+	if err != nil {
+		return nil, err
+	}
+	gw.conn = conn
+	return &gw, nil
+}
+
+// Write sends a record, records filtered by the sink level are empty
+func (gw *gelfWriter) Write(msg []byte) (int, error) {
+	record := bytes.TrimRight(msg, "\n")
+	if len(record) == 0 {
+		return len(msg), nil
+	}
+
+	var datagrams [][]byte
+	if gw.config.Network == GELFTCP {
+		frame := make([]byte, 0, len(record)+1)
+		datagrams = [][]byte{append(append(frame, record...), 0)}
+	} else {
+		data, err := gw.compress(record)
+		if err != nil {
+			return 0, err
+		}
+		datagrams, err = gw.chunk(data)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	gw.mut.Lock()
+	defer gw.mut.Unlock()
+
+	if gw.conn == nil {
+		return 0, fmt.Errorf("GELF writer closed")
+	}
+	for _, datagram := range datagrams {
+		if _, err := gw.conn.Write(datagram); err != nil {
+			if err = gw.reconnect(); err != nil {
+				return 0, err
+			}
+			if _, err = gw.conn.Write(datagram); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(msg), nil
+}
+
+// reconnect dials the server again, must be called with the mutex held
+func (gw *gelfWriter) reconnect() error {
+	gw.conn.Close()
+	conn, err := net.Dial(string(gw.config.Network), gw.config.Address)
+	if err != nil {
+		return err
+	}
+	gw.conn = conn
+	return nil
+}
+
+// compress returns the record compressed for udp
+func (gw *gelfWriter) compress(record []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch gw.config.Compression {
+	case GELFNone:
+		return record, nil
+	case GELFZlib:
+		zw := zlib.NewWriter(&buf)
+		if _, err = zw.Write(record); err == nil {
+			err = zw.Close()
+		}
+	case GELFGzip:
+		fallthrough
+	default:
+		zw := gzip.NewWriter(&buf)
+		if _, err = zw.Write(record); err == nil {
+			err = zw.Close()
+		}
+	}
+	return buf.Bytes(), err
+}
+
+// chunk returns the datagrams for a udp message
+// messages larger than ChunkSize are split into chunks with a random id
+func (gw *gelfWriter) chunk(data []byte) ([][]byte, error) {
+	if len(data) <= gw.config.ChunkSize {
+		return [][]byte{data}, nil
+	}
+
+	size := gw.config.ChunkSize - gelfChunkHeaderSize
+	if size <= 0 {
+		return nil, fmt.Errorf("GELF ChunkSize %d too small to chunk",
+			gw.config.ChunkSize)
+	}
+	count := (len(data) + size - 1) / size
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("GELF message of %d bytes too large to chunk",
+			len(data))
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, count)
+	for seq := 0; seq < count; seq++ {
+		end := (seq + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := make([]byte, 0, gelfChunkHeaderSize+end-seq*size)
+		chunk = append(chunk, gelfChunkMagic...)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(seq), byte(count))
+		chunks = append(chunks, append(chunk, data[seq*size:end]...))
+	}
+	return chunks, nil
+}
+
+// Sync meets the sinkCloser interface, messages are not buffered
+func (gw *gelfWriter) Sync() error {
+	return nil
+}
+
+// closeContext closes the connection to the gelf server
+func (gw *gelfWriter) closeContext(ctx context.Context) error {
+	gw.mut.Lock()
+	defer gw.mut.Unlock()
+
+	if gw.conn == nil {
+		return nil
+	}
+	err := gw.conn.Close()
+	gw.conn = nil
+	return err
+}
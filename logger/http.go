@@ -0,0 +1,475 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// httpModeType provides http request mode type
+type httpModeType string
+
+// Types of http request modes
+const (
+	// HTTPBatch sends the records of a batch in one request as a JSON array
+	HTTPBatch httpModeType = "batch" // default
+	// HTTPStructured sends each record of a batch in its own request
+	HTTPStructured httpModeType = "structured"
+)
+
+// Content types for http requests, see the cloudevents http binding
+const (
+	httpJSONContentType    = "application/json"
+	httpCEContentType      = "application/cloudevents+json"
+	httpCEBatchContentType = "application/cloudevents-batch+json"
+)
+
+// HTTPConfiguration provides http sink configuration type
+type HTTPConfiguration struct {
+	URL          string
+	Mode         httpModeType
+	Headers      map[string]string
+	BearerToken  string
+	Username     string // basic auth, ignored if BearerToken set
+	Password     string
+	BatchSize    int           // records sent when the batch is full
+	FlushFreq    time.Duration // or when the batch is this old
+	QueueSize    int           // batches waiting to be sent
+	Timeout      time.Duration // per request
+	RetryMax     int           // retries for 429 and 5xx responses
+	RetryFreq    time.Duration // first backoff, doubled for each retry
+	TLSCfg       *tls.Config   `json:"-" yaml:"-"`
+	ErrorHandler ErrorFunc     `json:"-" yaml:"-"` // called with URL and body
+}
+
+// getHTTPFormat returns the format of the http sink, json if not set
+func getHTTPFormat(format FormatType) FormatType {
+	if format == "" {
+		return JSONFormat
+	}
+	return format
+}
+
+// httpRecord provides a record waiting to be sent
+type httpRecord struct {
+	line   []byte
+	time   time.Time
+	labels map[string]string // loki stream labels
+	index  string            // elasticsearch index
+}
+
+// httpBody provides a request body and the number of records it holds
+type httpBody struct {
+	data  []byte
+	count int
+}
+
+// encodeFunc func returns the request bodies for a batch of records
+type encodeFunc func(batch []httpRecord) ([]httpBody, error)
+
+// checkFunc func returns the number of records a successful response
+// reports as rejected and the reason
+type checkFunc func(reply []byte) (int, error)
+
+// sendFunc func sends a request body once and returns the response body,
+// whether to retry and how long the server asked to wait before retrying
+type sendFunc func(body []byte) ([]byte, bool, time.Duration, error)
+
+// httpWriter is a zap WriteSyncer (io.Writer) that posts batches of records
+type httpWriter struct {
+	config      HTTPConfiguration
+	client      *http.Client
+	contentType string
+	encode      encodeFunc
+	check       checkFunc  // nil if a successful response accepts all records
+	send        sendFunc   // request unless the records are not posted
+	mut         sync.Mutex // protects batch and stopped
+	batch       []httpRecord
+	stopped     bool
+	batches     chan []httpRecord
+	queued      uint64     // batches queued, protected by mut
+	sentMut     sync.Mutex // protects sent
+	sentCond    *sync.Cond // broadcast when a batch has been sent
+	sent        uint64     // batches sent or dropped by the sender
+	dropped     uint64     // Records not delivered, must access atomically
+	closed      int32      // Nonzero if closing, must access atomically
+	closeMut    sync.Mutex
+	stopFlush   chan struct{} // Closed to stop the flusher
+	flushDone   chan struct{} // Closed when the flusher has stopped
+	abort       chan struct{} // Closed to stop retrying when close times out
+	abortOnce   sync.Once
+	done        chan struct{} // Closed when the sender has stopped
+}
+
+// newHTTPWriter returns an http writer instance for the http sink
+func newHTTPWriter(config HTTPConfiguration, format FormatType) *httpWriter {
+	contentType := httpJSONContentType
+	if getHTTPFormat(format) == CEFormat {
+		if config.Mode == HTTPStructured {
+			contentType = httpCEContentType
+		} else {
+			contentType = httpCEBatchContentType
+		}
+	}
+	return newBatchWriter(config, contentType, httpEncoder(config.Mode))
+}
+
+// httpEncoder returns the encoder for the http sink request mode
+func httpEncoder(mode httpModeType) encodeFunc {
+	return func(batch []httpRecord) ([]httpBody, error) {
+		if mode == HTTPStructured {
+			bodies := make([]httpBody, len(batch))
+			for i, record := range batch {
+				bodies[i] = httpBody{record.line, 1}
+			}
+			return bodies, nil
+		}
+		lines := make([][]byte, len(batch))
+		for i, record := range batch {
+			lines[i] = record.line
+		}
+		data := append([]byte("["), bytes.Join(lines, []byte(","))...)
+		return []httpBody{{append(data, ']'), len(batch)}}, nil
+	}
+}
+
+// newBatchWriter returns a writer posting batches encoded by encode
+func newBatchWriter(config HTTPConfiguration, contentType string,
+	encode encodeFunc) *httpWriter {
+	hw := &httpWriter{
+		config:      config,
+		contentType: contentType,
+		encode:      encode,
+		stopFlush:   make(chan struct{}),
+		flushDone:   make(chan struct{}),
+		abort:       make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	hw.sentCond = sync.NewCond(&hw.sentMut)
+	if config.URL == "" {
+		hw.config.URL = defaultHTTPConfiguration.URL
+	}
+	if config.BatchSize == 0 {
+		hw.config.BatchSize = defaultHTTPConfiguration.BatchSize
+	}
+	if config.FlushFreq == 0 {
+		hw.config.FlushFreq = defaultHTTPConfiguration.FlushFreq
+	}
+	if config.QueueSize == 0 {
+		hw.config.QueueSize = defaultHTTPConfiguration.QueueSize
+	}
+	if config.Timeout == 0 {
+		hw.config.Timeout = defaultHTTPConfiguration.Timeout
+	}
+	if config.RetryFreq == 0 {
+		hw.config.RetryFreq = defaultHTTPConfiguration.RetryFreq
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config.TLSCfg
+	hw.client = &http.Client{
+		Transport: transport,
+		Timeout:   hw.config.Timeout,
+	}
+	hw.batches = make(chan []httpRecord, hw.config.QueueSize)
+	hw.send = hw.request
+
+	go hw.flusher()
+	go hw.sender()
+	return hw
+}
+
+// Write adds a record to the batch (Thread-safe)
+// Write might block if the queue of batches to send is full
+func (hw *httpWriter) Write(msg []byte) (int, error) {
+	// encoders reuse their buffers so the record is copied
+	line := append([]byte(nil), bytes.TrimRight(msg, "\n")...)
+	if err := hw.add(httpRecord{line: line}); err != nil {
+		return 0, err
+	}
+	return len(msg), nil
+}
+
+// add adds a record to the batch, queuing the batch when it is full
+func (hw *httpWriter) add(record httpRecord) error {
+	hw.mut.Lock()
+	defer hw.mut.Unlock()
+
+	if hw.stopped {
+		return syscall.EINVAL
+	}
+	hw.batch = append(hw.batch, record)
+	if len(hw.batch) >= hw.config.BatchSize {
+		hw.enqueue()
+	}
+	return nil
+}
+
+// enqueue queues the batch to be sent, must be called with the mutex held
+// the batch is dropped if sending is aborted while the queue is full
+func (hw *httpWriter) enqueue() {
+	if len(hw.batch) == 0 {
+		return
+	}
+	select {
+	case hw.batches <- hw.batch:
+		hw.queued++
+	case <-hw.abort:
+		hw.handleError(nil, len(hw.batch),
+			errors.New("HTTP sink closed with the queue full"))
+	}
+	hw.batch = nil
+}
+
+// abortSend stops retries and queuing so close does not wait any longer
+func (hw *httpWriter) abortSend() {
+	hw.abortOnce.Do(func() {
+		close(hw.abort)
+	})
+}
+
+// flush queues the records that have not been sent yet
+func (hw *httpWriter) flush() {
+	hw.mut.Lock()
+	defer hw.mut.Unlock()
+
+	if !hw.stopped {
+		hw.enqueue()
+	}
+}
+
+// flusher queues the batch every FlushFreq so records are not held
+func (hw *httpWriter) flusher() {
+	defer close(hw.flushDone)
+	ticker := time.NewTicker(hw.config.FlushFreq)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			hw.flush()
+		case <-hw.stopFlush:
+			return
+		}
+	}
+}
+
+// sender posts the queued batches in order
+func (hw *httpWriter) sender() {
+	defer close(hw.done)
+	for batch := range hw.batches {
+		bodies, err := hw.encode(batch)
+		if err != nil {
+			hw.handleError(nil, len(batch), err)
+		}
+		for _, body := range bodies {
+			hw.post(body.data, body.count)
+		}
+		hw.sentMut.Lock()
+		hw.sent++
+		hw.sentCond.Broadcast()
+		hw.sentMut.Unlock()
+	}
+}
+
+// post sends a request body holding count records
+// retries with backoff on 429 and 5xx responses and on transport errors
+func (hw *httpWriter) post(body []byte, count int) {
+	backoff := hw.config.RetryFreq
+	for retries := 0; ; retries++ {
+		reply, retry, wait, err := hw.send(body)
+		if err == nil {
+			if hw.check != nil {
+				if rejected, err := hw.check(reply); err != nil {
+					hw.handleError(body, rejected, err)
+				}
+			}
+			return
+		}
+		if !retry || retries >= hw.config.RetryMax {
+			hw.handleError(body, count, err)
+			return
+		}
+		if wait == 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		select {
+		case <-time.After(wait):
+		case <-hw.abort:
+			hw.handleError(body, count, err)
+			return
+		}
+	}
+}
+
+// request posts the body once and returns the response body, whether to
+// retry and how long the server asked to wait before retrying, if it did
+func (hw *httpWriter) request(body []byte) ([]byte, bool, time.Duration,
+	error) {
+	req, err := http.NewRequest(http.MethodPost, hw.config.URL,
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, false, 0, err
+	}
+	req.Header.Set("Content-Type", hw.contentType)
+	for key, value := range hw.config.Headers {
+		req.Header.Set(key, value)
+	}
+	if hw.config.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+hw.config.BearerToken)
+	} else if hw.config.Username != "" {
+		req.SetBasicAuth(hw.config.Username, hw.config.Password)
+	}
+
+	resp, err := hw.client.Do(req)
+	if err != nil {
+		return nil, true, 0, err
+	}
+	reply, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// the response body explains why the request was rejected
+	reason := bytes.TrimSpace(reply)
+	if len(reason) > 512 {
+		reason = reason[:512]
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= http.StatusInternalServerError:
+		wait, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return nil, true, time.Duration(wait) * time.Second,
+			fmt.Errorf("HTTP sink response: %s %s", resp.Status, reason)
+	case resp.StatusCode >= http.StatusMultipleChoices:
+		return nil, false, 0, fmt.Errorf("HTTP sink response: %s %s",
+			resp.Status, reason)
+	}
+	return reply, false, 0, nil
+}
+
+// handleError passes a failed request to the error handler
+// the records are counted as dropped
+func (hw *httpWriter) handleError(body []byte, count int, err error) {
+	atomic.AddUint64(&hw.dropped, uint64(count))
+	if hw.config.ErrorHandler != nil {
+		hw.config.ErrorHandler(hw.config.URL, body, err)
+	} else {
+		fmt.Fprintf(os.Stderr, "HTTP sink dropped %d records: %s\n", count,
+			err)
+	}
+}
+
+// Sync satisfies zapcore.WriteSyncer interface
+// Sync sends the current batch and waits for the batches queued before it
+// batches are sent in order, so later batches do not hold up Sync
+func (hw *httpWriter) Sync() error {
+	hw.mut.Lock()
+	if !hw.stopped {
+		hw.enqueue()
+	}
+	queued := hw.queued
+	hw.mut.Unlock()
+
+	hw.sentMut.Lock()
+	defer hw.sentMut.Unlock()
+	for hw.sent < queued {
+		hw.sentCond.Wait()
+	}
+	return nil
+}
+
+// Closed returns true if the writer is closed, false otherwise (Thread-safe)
+func (hw *httpWriter) Closed() bool {
+	return atomic.LoadInt32(&hw.closed) != 0
+}
+
+// closeContext sends the remaining records until ctx done
+// returns an error if ctx expires first or if any records were dropped
+func (hw *httpWriter) closeContext(ctx context.Context) error {
+	hw.closeMut.Lock()
+	defer hw.closeMut.Unlock()
+
+	if hw.Closed() {
+		return syscall.EINVAL
+	}
+
+	atomic.StoreInt32(&hw.closed, 1)
+
+	// writers waiting for a full queue are released once ctx is done
+	closing := make(chan struct{})
+	defer close(closing)
+	go func() {
+		select {
+		case <-ctx.Done():
+			hw.abortSend()
+		case <-closing:
+		}
+	}()
+
+	close(hw.stopFlush)
+	<-hw.flushDone
+
+	hw.mut.Lock()
+	hw.enqueue()
+	hw.stopped = true
+	close(hw.batches)
+	hw.mut.Unlock()
+
+	select {
+	case <-hw.done:
+	case <-ctx.Done():
+		hw.abortSend()
+		return fmt.Errorf("HTTP sink close: %w", ctx.Err())
+	}
+
+	if dropped := atomic.LoadUint64(&hw.dropped); dropped > 0 {
+		return fmt.Errorf("HTTP sink dropped %d records", dropped)
+	}
+	return nil
+}
+
+// LogrusHTTPHook provides an http sink hook
+type LogrusHTTPHook struct {
+	writer    *httpWriter
+	formatter logrus.Formatter
+}
+
+// newLogrusHTTPHook returns an http sink hook instance
+func newLogrusHTTPHook(writer *httpWriter,
+	fmt logrus.Formatter) *LogrusHTTPHook {
+	return &LogrusHTTPHook{
+		writer:    writer,
+		formatter: fmt,
+	}
+}
+
+// Levels returns all log levels that are enabled
+func (h *LogrusHTTPHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire adds the entry to the batch to send
+func (h *LogrusHTTPHook) Fire(entry *logrus.Entry) error {
+	msg, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		// filtered by the http level
+		return nil
+	}
+	_, err = h.writer.Write(msg)
+	return err
+}
@@ -1,15 +1,26 @@
 package logger
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	stdlog "log"
 	"os"
+	"regexp"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
 )
 
 // TopicKey is LogFields key to pass topic through WithFields
@@ -64,12 +75,167 @@ const (
 	WaitForAll ackWaitType = "all"
 )
 
+// fallbackType provides the sink for undeliverable kafka messages
+type fallbackType string
+
+// Types of fallback sinks for messages kafka failed to deliver
+const (
+	FallbackNone    fallbackType = "none" // default
+	FallbackConsole fallbackType = "console"
+	FallbackFile    fallbackType = "file"
+)
+
+// tlsVersionType provides the minimum TLS version
+type tlsVersionType string
+
+// TLS versions to map to crypto/tls
+const (
+	TLSVersion10 tlsVersionType = "1.0"
+	TLSVersion11 tlsVersionType = "1.1"
+	TLSVersion12 tlsVersionType = "1.2" // default
+	TLSVersion13 tlsVersionType = "1.3"
+)
+
+// saslMechanismType provides the SASL authentication mechanism
+type saslMechanismType string
+
+// SASL mechanisms to map to sarama
+const (
+	SASLPlain       saslMechanismType = "PLAIN" // default
+	SASLSCRAMSHA256 saslMechanismType = "SCRAM-SHA-256"
+	SASLSCRAMSHA512 saslMechanismType = "SCRAM-SHA-512"
+)
+
+// flushInterval is how often flush checks for outstanding messages
+const flushInterval = 10 * time.Millisecond
+
+// syncTimeout bounds how long Sync waits for messages to be acked or failed
+// as the broker may be down when a record above error level is flushed,
+// tests shorten it
+var syncTimeout = 5 * time.Second
+
+// newAsyncProducer creates the sarama producer, tests substitute a mock
+var newAsyncProducer = sarama.NewAsyncProducer
+
+// ErrorFunc func called with each message kafka failed to deliver
+type ErrorFunc func(topic string, msg []byte, err error)
+
 // FilterFunc func to add/modify/remove message map entries and return kafka key
 type FilterFunc func(*map[string]interface{})
 
 // KeyFunc func to return key calculated from kafka message contents
 type KeyFunc func(*map[string]interface{}) string
 
+// kafkaLayout provides the keys and cloudevents fields of kafka records in
+// json or cloudevents format, sinks hand the fields of each record to the
+// producer so records are encoded once after routing, keys and filters
+type kafkaLayout struct {
+	timeKey    string // empty if timestamps are disabled
+	levelKey   string
+	messageKey string
+	fields     LogFields // cloudevents fields of cloudevents format
+}
+
+// getKafkaLayout returns the layout of kafka records, nil for formats other
+// than json and cloudevents which sinks encode before sending
+func getKafkaLayout(config LoggerConfiguration,
+	cloudEvents *CloudEvents) *kafkaLayout {
+
+	layout := &kafkaLayout{levelKey: "level", messageKey: "msg"}
+	if config.EnableTimeStamps {
+		layout.timeKey = CETimeKey
+	}
+	switch config.KafkaFormat {
+	case JSONFormat:
+	case CEFormat:
+		if cloudEvents != nil {
+			layout.messageKey = CEDataKey
+			if config.CloudEventsCfg.SetSubjectLevel {
+				layout.levelKey = CESubjectKey
+			}
+			layout.fields = cloudEvents.fields
+		}
+	default:
+		return nil
+	}
+	return layout
+}
+
+// newKafkaLayout returns the layout of kafka records, benchmarks substitute
+// one returning nil to measure records encoded and decoded again
+var newKafkaLayout = getKafkaLayout
+
+// record adds the time, level and message to the fields of a record
+// cloudevents fields replace fields with their keys, the time, level and
+// message are only added if there are no fields with their keys, as the
+// last of duplicate keys is used when the encoded record is decoded
+func (kl *kafkaLayout) record(level string, t time.Time, msg string,
+	msgMap map[string]interface{}) map[string]interface{} {
+
+	for key, value := range kl.fields {
+		msgMap[key] = value
+	}
+	if _, ok := msgMap[kl.timeKey]; !ok && kl.timeKey != "" {
+		msgMap[kl.timeKey] = t.Format(time.RFC3339)
+	}
+	if _, ok := msgMap[kl.levelKey]; !ok {
+		msgMap[kl.levelKey] = level
+	}
+	if _, ok := msgMap[kl.messageKey]; !ok {
+		msgMap[kl.messageKey] = msg
+	}
+	return msgMap
+}
+
+// kafkaFuncs provides the filter and key functions of a logger
+// loggers derived with more functions get a new list, so functions only
+// apply to the records of the logger they were added to and its children
+type kafkaFuncs struct {
+	filters []FilterFunc // called in the order they were added
+	keyFn   KeyFunc      // the last key function added
+}
+
+// kafkaFuncsKey provides the context key for the kafka functions of a record
+type kafkaFuncsKey struct{}
+
+// withFilter returns the functions with filterFn added, nil kf has none
+func (kf *kafkaFuncs) withFilter(filterFn FilterFunc) *kafkaFuncs {
+	funcs := &kafkaFuncs{}
+	if kf != nil {
+		funcs.filters = make([]FilterFunc, len(kf.filters), len(kf.filters)+1)
+		copy(funcs.filters, kf.filters)
+		funcs.keyFn = kf.keyFn
+	}
+	funcs.filters = append(funcs.filters, filterFn)
+	return funcs
+}
+
+// withKey returns the functions with keyFn replacing the key function
+func (kf *kafkaFuncs) withKey(keyFn KeyFunc) *kafkaFuncs {
+	funcs := &kafkaFuncs{keyFn: keyFn}
+	if kf != nil {
+		funcs.filters = kf.filters
+	}
+	return funcs
+}
+
+// withKafkaFuncs returns ctx carrying the kafka functions of a record
+func withKafkaFuncs(ctx context.Context, funcs *kafkaFuncs) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, kafkaFuncsKey{}, funcs)
+}
+
+// getKafkaFuncs returns the kafka functions ctx carries, nil if none
+func getKafkaFuncs(ctx context.Context) *kafkaFuncs {
+	if ctx == nil {
+		return nil
+	}
+	funcs, _ := ctx.Value(kafkaFuncsKey{}).(*kafkaFuncs)
+	return funcs
+}
+
 // ProducerConfiguration provides kafka producer configuration type
 type ProducerConfiguration struct {
 	Brokers       []string
@@ -85,10 +251,56 @@ type ProducerConfiguration struct {
 	MetaRetryMax  int
 	MetaRetryFreq time.Duration
 	EnableTLS     bool
-	TLSCfg        *tls.Config
+	TLSCfg        *tls.Config    `json:"-" yaml:"-"` // used instead of TLS files
+	TLSCAFile     string         // PEM CA certificates, system pool if not set
+	TLSCertFile   string         // PEM client certificate, needs TLSKeyFile
+	TLSKeyFile    string         // PEM client private key
+	TLSServerName string         // verified broker name, broker host if not set
+	TLSSkipVerify bool           // accept any broker certificate, insecure
+	TLSMinVersion tlsVersionType // minimum TLS version
+	EnableSASL    bool
+	SASLMechanism saslMechanismType
+	SASLUsername  string
+	SASLPassword  string
 	EnableDebug   bool
-	filterFn      FilterFunc
-	keyFn         KeyFunc
+	Fallback      fallbackType
+	EnableSpool   bool
+	SpoolCfg      SpoolConfiguration
+	Routes        []RouteConfiguration // evaluated in order for each record
+	HeaderFields  []string             // fields also sent as record headers
+	RemoveHeaders bool                 // header fields removed from the body
+	ErrorHandler  ErrorFunc            `json:"-" yaml:"-"`
+}
+
+// RouteConfiguration provides a kafka routing rule
+// a rule matches a record if all the conditions it sets match
+// the first matching rule picks the topic and key or drops the record
+// Example: {Fields: {"audit": ""}, Topic: "audit"} sends records with an
+// audit field to the audit topic
+type RouteConfiguration struct {
+	Levels  []LevelType       // record level is one of these
+	Fields  map[string]string // fields are present, with the value if not empty
+	Message string            // regexp matching the record message
+	Topic   string            // topic of matching records, Topic if not set
+	Key     kafkaKeyType      // key of matching records, Key if not set
+	KeyName string            // key name of matching records, KeyName if not set
+	Drop    bool              // matching records are not sent
+}
+
+// kafkaRoute provides a routing rule with its message regexp compiled
+type kafkaRoute struct {
+	RouteConfiguration
+	message *regexp.Regexp
+}
+
+// ProducerStats provides kafka producer message counters
+type ProducerStats struct {
+	Sent     uint64 // Handed to the producer
+	Acked    uint64 // Acknowledged by the broker
+	Failed   uint64 // Not delivered after retries
+	Dropped  uint64 // Failed and neither spooled nor written to fallback sink
+	Spooled  uint64 // Written to the disk spool
+	Replayed uint64 // Delivered from the disk spool
 }
 
 // KafkaProducer wraps sarama producer with config
@@ -97,7 +309,23 @@ type KafkaProducer struct {
 	config      ProducerConfiguration
 	cloudEvents *CloudEvents
 	enableCE    bool
+	ceBinary    bool
 	levelKey    string
+	messageKey  string
+	routes      []kafkaRoute
+	fallback    io.Writer
+	spool       *kafkaSpool
+	healthy     int32  // Zero after a delivery failure, must access atomically
+	sent        uint64 // Message counters, must access atomically
+	acked       uint64
+	failed      uint64
+	dropped     uint64
+	spooled     uint64
+	replayed    uint64
+	readersWg   sync.WaitGroup // WaitGroup for result channel readers
+	done        chan struct{}  // Closed when the producer has shut down
+	stopReplay  chan struct{}  // Closed to stop the spool replayer
+	replayDone  chan struct{}  // Closed when the spool replayer has stopped
 }
 
 // newKafkaProducer returns a kafka producer instance
@@ -109,9 +337,9 @@ func newKafkaProducer(config ProducerConfiguration, cloudEvents *CloudEvents,
 	}
 
 	cfg := sarama.NewConfig()
-	// TODO Consider reading Errors or Successes channels with goroutines
-	cfg.Producer.Return.Errors = false
-	cfg.Producer.Return.Successes = false
+	// results are read by goroutines to count and report deliveries
+	cfg.Producer.Return.Errors = true
+	cfg.Producer.Return.Successes = true
 
 	cfg.Producer.Flush.Frequency = config.ProdFlushFreq
 	cfg.Producer.Retry.Max = config.ProdRetryMax
@@ -157,25 +385,65 @@ func newKafkaProducer(config ProducerConfiguration, cloudEvents *CloudEvents,
 	}
 
 	if config.EnableTLS {
+		tlsConfig, err := getProducerTLS(config)
+		if err != nil {
+			return &KafkaProducer{}, err
+		}
 		cfg.Net.TLS.Enable = true
-		cfg.Net.TLS.Config = config.TLSCfg
+		cfg.Net.TLS.Config = tlsConfig
+	}
+
+	if config.EnableSASL {
+		cfg.Net.SASL.Enable = true
+		cfg.Net.SASL.User = config.SASLUsername
+		cfg.Net.SASL.Password = config.SASLPassword
+		switch config.SASLMechanism {
+		case SASLSCRAMSHA256:
+			cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return newSCRAMClient(sha256.New)
+			}
+		case SASLSCRAMSHA512:
+			cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return newSCRAMClient(sha512.New)
+			}
+		case SASLPlain:
+			fallthrough
+		default:
+			cfg.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		}
 	}
 
 	var enableCE bool = false
+	var ceBinary bool = false
 	var levelKey string = "level"
+	var messageKey string = "msg"
 	if cloudEvents != nil {
 		enableCE = true
+		ceBinary = ceConfig.Mode == CEBinary
+		messageKey = CEDataKey
 		if ceConfig.SetSubjectLevel {
 			levelKey = CESubjectKey
 		}
 	}
 
+	routes, err := getKafkaRoutes(config.Routes)
+	if err != nil {
+		return &KafkaProducer{}, err
+	}
+
 	kp := KafkaProducer{
 		// producer:    producer,
 		config:      config,
 		cloudEvents: cloudEvents,
 		enableCE:    enableCE,
+		ceBinary:    ceBinary,
 		levelKey:    levelKey,
+		messageKey:  messageKey,
+		routes:      routes,
+		healthy:     1,
+		done:        make(chan struct{}),
 	}
 
 	if len(config.Brokers) == 0 || config.Brokers[0] == "" {
@@ -188,36 +456,325 @@ func newKafkaProducer(config ProducerConfiguration, cloudEvents *CloudEvents,
 		kp.config.KeyName = defaultProducerConfiguration.KeyName
 	}
 
-	producer, err := sarama.NewAsyncProducer(kp.config.Brokers, cfg)
+	if config.EnableSpool {
+		spool, err := openKafkaSpool(config.SpoolCfg)
+		if err != nil {
+			return &KafkaProducer{}, err
+		}
+		kp.spool = spool
+	}
+
+	producer, err := newAsyncProducer(kp.config.Brokers, cfg)
 	if err != nil {
+		if kp.spool != nil {
+			kp.spool.release()
+		}
 		return &KafkaProducer{}, err
 	}
 	kp.producer = producer
+	kp.startReaders()
+
+	if kp.spool != nil {
+		kp.stopReplay = make(chan struct{})
+		kp.replayDone = make(chan struct{})
+		go kp.replaySpool()
+	}
 
 	return &kp, nil
 }
 
-// setFilterFn sets the kafka message filter function
-func (kp *KafkaProducer) setFilterFn(filterFn FilterFunc) {
-	kp.config.filterFn = filterFn
+// getKafkaRoutes returns the routing rules with their regexps compiled
+func getKafkaRoutes(config []RouteConfiguration) ([]kafkaRoute, error) {
+	routes := make([]kafkaRoute, len(config))
+	for i, route := range config {
+		routes[i].RouteConfiguration = route
+		if route.Message == "" {
+			continue
+		}
+		message, err := regexp.Compile(route.Message)
+		if err != nil {
+			return nil, fmt.Errorf("Kafka route %d message: %w", i, err)
+		}
+		routes[i].message = message
+	}
+	return routes, nil
+}
+
+// getTLSVersion converts the TLS version to crypto/tls
+func getTLSVersion(version tlsVersionType) uint16 {
+	switch version {
+	case TLSVersion10:
+		return tls.VersionTLS10
+	case TLSVersion11:
+		return tls.VersionTLS11
+	case TLSVersion13:
+		return tls.VersionTLS13
+	case TLSVersion12:
+		fallthrough
+	default:
+		return tls.VersionTLS12
+	}
+}
+
+// getProducerTLS returns the TLS config of the producer
+// TLSCfg is used if set, otherwise the config is built from the TLS files
+func getProducerTLS(config ProducerConfiguration) (*tls.Config, error) {
+	if config.TLSCfg != nil {
+		return config.TLSCfg, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         config.TLSServerName,
+		InsecureSkipVerify: config.TLSSkipVerify,
+		MinVersion:         getTLSVersion(config.TLSMinVersion),
+	}
+	if config.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(config.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Kafka TLS CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("Kafka TLS CA file %s has no certificates",
+				config.TLSCAFile)
+		}
+	}
+	if config.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Kafka TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// scramClient adapts an xdg-go/scram conversation to sarama.SCRAMClient
+type scramClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+// newSCRAMClient returns a SCRAM client using the hash function
+func newSCRAMClient(hash scram.HashGeneratorFcn) *scramClient {
+	return &scramClient{HashGeneratorFcn: hash}
+}
+
+// Begin starts a SCRAM exchange with the credentials
+func (sc *scramClient) Begin(userName, password, authzID string) error {
+	client, err := sc.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	sc.Client = client
+	sc.ClientConversation = client.NewConversation()
+	return nil
+}
+
+// Step returns the response to a server challenge
+func (sc *scramClient) Step(challenge string) (string, error) {
+	return sc.ClientConversation.Step(challenge)
+}
+
+// Done returns true once the exchange is complete
+func (sc *scramClient) Done() bool {
+	return sc.ClientConversation.Done()
 }
 
-// setKeyFn sets the kafka message key function
-func (kp *KafkaProducer) setKeyFn(keyFn KeyFunc) {
-	kp.config.keyFn = keyFn
+// startReaders starts the goroutines that consume the result channels
+// done is closed once both channels are closed by the producer shutting down
+func (kp *KafkaProducer) startReaders() {
+	kp.readersWg.Add(2)
+	go kp.readSuccesses()
+	go kp.readErrors()
+	go func() {
+		kp.readersWg.Wait()
+		close(kp.done)
+	}()
+}
+
+// readSuccesses counts messages acknowledged by the broker
+// results of messages replayed from the spool are passed to their batch
+func (kp *KafkaProducer) readSuccesses() {
+	defer kp.readersWg.Done()
+	for msg := range kp.producer.Successes() {
+		if batch, ok := msg.Metadata.(*replayBatch); ok {
+			batch.done(nil)
+			continue
+		}
+		atomic.AddUint64(&kp.acked, 1)
+		if kp.spool != nil && kp.spool.empty() {
+			kp.setHealthy(true)
+		}
+	}
+}
+
+// readErrors counts and reports messages the producer failed to deliver
+// results of messages replayed from the spool are passed to their batch
+func (kp *KafkaProducer) readErrors() {
+	defer kp.readersWg.Done()
+	for perr := range kp.producer.Errors() {
+		if perr.Msg != nil {
+			if batch, ok := perr.Msg.Metadata.(*replayBatch); ok {
+				batch.done(perr.Err)
+				continue
+			}
+		}
+		atomic.AddUint64(&kp.failed, 1)
+		kp.handleError(perr)
+	}
+}
+
+// handleError passes a failed message to the error handler and then
+// to the spool or fallback sink, messages neither takes are counted as dropped
+func (kp *KafkaProducer) handleError(perr *sarama.ProducerError) {
+	var topic string
+	var msg []byte
+	if perr.Msg != nil {
+		topic = perr.Msg.Topic
+		if perr.Msg.Value != nil {
+			msg, _ = perr.Msg.Value.Encode()
+		}
+	}
+
+	if kp.config.ErrorHandler != nil {
+		kp.config.ErrorHandler(topic, msg, perr.Err)
+	}
+
+	if kp.spool != nil && perr.Msg != nil {
+		kp.setHealthy(false)
+		if err := kp.spoolMessage(perr.Msg); err == nil {
+			return
+		}
+	}
+
+	if kp.fallbackMessage(msg) {
+		return
+	}
+
+	atomic.AddUint64(&kp.dropped, 1)
+	if kp.config.ErrorHandler == nil {
+		fmt.Fprintf(os.Stderr, "Kafka message dropped: %s\n", perr.Err)
+	}
+}
+
+// fallbackMessage writes a message kafka did not take to the fallback sink
+// returns false if there is no fallback sink or the write failed
+func (kp *KafkaProducer) fallbackMessage(msg []byte) bool {
+	if kp.fallback == nil {
+		return false
+	}
+	line := make([]byte, 0, len(msg)+1)
+	line = append(append(line, msg...), '\n')
+	_, err := kp.fallback.Write(line)
+	return err == nil
+}
+
+// Stats returns the current message counters
+func (kp *KafkaProducer) Stats() ProducerStats {
+	return ProducerStats{
+		Sent:     atomic.LoadUint64(&kp.sent),
+		Acked:    atomic.LoadUint64(&kp.acked),
+		Failed:   atomic.LoadUint64(&kp.failed),
+		Dropped:  atomic.LoadUint64(&kp.dropped),
+		Spooled:  atomic.LoadUint64(&kp.spooled),
+		Replayed: atomic.LoadUint64(&kp.replayed),
+	}
+}
+
+// inFlight returns the number of messages neither acked nor failed
+func (stats ProducerStats) inFlight() uint64 {
+	return stats.Sent - stats.Acked - stats.Failed
+}
+
+// flush waits until all messages sent before the call are acked or failed
+func (kp *KafkaProducer) flush(ctx context.Context) error {
+	sent := atomic.LoadUint64(&kp.sent)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		stats := kp.Stats()
+		if stats.Acked+stats.Failed >= sent {
+			return nil
+		}
+		select {
+		case <-kp.done:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("Kafka producer flush: %w, %d messages in flight",
+				ctx.Err(), stats.inFlight())
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync waits up to syncTimeout until all messages sent before the call
+// are acked or failed
+func (kp *KafkaProducer) sync() error {
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	return kp.flush(ctx)
+}
+
+// close flushes buffered messages and shuts down the producer
+// returns an error if ctx expires first or if any messages were dropped
+// spooled messages remain on disk to be replayed by the next producer
+func (kp *KafkaProducer) close(ctx context.Context) error {
+	if kp.spool != nil {
+		close(kp.stopReplay)
+		select {
+		case <-kp.replayDone:
+		case <-ctx.Done():
+			return fmt.Errorf("Kafka spool replay: %w", ctx.Err())
+		}
+	}
+
+	kp.producer.AsyncClose()
+	select {
+	case <-kp.done:
+	case <-ctx.Done():
+		return fmt.Errorf("Kafka producer close: %w, %d messages in flight",
+			ctx.Err(), kp.Stats().inFlight())
+	}
+
+	if kp.spool != nil {
+		if err := kp.spool.release(); err != nil {
+			return err
+		}
+	}
+	if dropped := atomic.LoadUint64(&kp.dropped); dropped > 0 {
+		return fmt.Errorf("Kafka producer dropped %d messages", dropped)
+	}
+	return nil
+}
+
+// setLayout sets the keys of the level and message of records
+func (kp *KafkaProducer) setLayout(layout *kafkaLayout) {
+	if layout != nil {
+		kp.levelKey = layout.levelKey
+		kp.messageKey = layout.messageKey
+	}
+}
+
+// setFallback sets the sink for messages kafka failed to deliver
+func (kp *KafkaProducer) setFallback(fallback io.Writer) {
+	kp.fallback = fallback
 }
 
 func (kp *KafkaProducer) getKey(msgMap map[string]interface{},
+	keyType kafkaKeyType, keyName string, keyFn KeyFunc,
 	key *sarama.Encoder) error {
 
-	// get key based on kp config
-	switch kp.config.Key {
+	// get key based on kp config or route
+	switch keyType {
 	case FixedKey:
-		*key = sarama.StringEncoder(kp.config.KeyName)
+		*key = sarama.StringEncoder(keyName)
 	case ExtractedKey:
-		if name, ok := msgMap[kp.config.KeyName].(string); ok {
+		if name, ok := msgMap[keyName].(string); ok {
 			*key = sarama.StringEncoder(name)
-			delete(msgMap, kp.config.KeyName)
+			delete(msgMap, keyName)
 		} else {
 			return errors.New("Extracted key missing")
 		}
@@ -226,8 +783,8 @@ func (kp *KafkaProducer) getKey(msgMap map[string]interface{},
 	case TimeNanoSecondKey:
 		*key = sarama.StringEncoder(strconv.Itoa(int(time.Now().UnixNano())))
 	case FunctionKey:
-		if kp.config.keyFn != nil {
-			*key = sarama.StringEncoder(kp.config.keyFn(&msgMap))
+		if keyFn != nil {
+			*key = sarama.StringEncoder(keyFn(&msgMap))
 			break
 		}
 		fallthrough
@@ -239,8 +796,56 @@ func (kp *KafkaProducer) getKey(msgMap map[string]interface{},
 	return nil
 }
 
+// route returns the first routing rule matching the message, nil if none
+func (kp *KafkaProducer) route(msgMap map[string]interface{}) *kafkaRoute {
+	for i := range kp.routes {
+		if kp.routes[i].matches(msgMap, kp.levelKey, kp.messageKey) {
+			return &kp.routes[i]
+		}
+	}
+	return nil
+}
+
+// matches returns true if the message meets all conditions of the route
+func (kr *kafkaRoute) matches(msgMap map[string]interface{}, levelKey string,
+	messageKey string) bool {
+
+	if len(kr.Levels) > 0 {
+		level, _ := msgMap[levelKey].(string)
+		if level == "warning" {
+			// logrus names the warn level warning
+			level = string(WarnType)
+		}
+		found := false
+		for _, routeLevel := range kr.Levels {
+			if LevelType(level) == routeLevel {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for name, value := range kr.Fields {
+		field, ok := msgMap[name]
+		if !ok || (value != "" && fmt.Sprint(field) != value) {
+			return false
+		}
+	}
+	if kr.message != nil {
+		message, _ := msgMap[messageKey].(string)
+		if !kr.message.MatchString(message) {
+			return false
+		}
+	}
+	return true
+}
+
 // sendMessage adds key and cloudevents ID before sending message to kafka
-func (kp *KafkaProducer) sendMessage(msg []byte) error {
+// funcs are the filter and key functions of the logger of the record
+// sinks with a kafka layout use sendFields to avoid decoding the message
+func (kp *KafkaProducer) sendMessage(msg []byte, funcs *kafkaFuncs) error {
 	var msgMap map[string]interface{}
 
 	// unmarshal message to access fields
@@ -248,25 +853,60 @@ func (kp *KafkaProducer) sendMessage(msg []byte) error {
 	if err != nil {
 		return err
 	}
+	return kp.sendFields(msgMap, funcs)
+}
+
+// sendFields routes, keys and filters the fields of a record, adds the
+// cloudevents ID and sends the record encoded once
+// msgMap is modified, the caller must not use it afterwards
+func (kp *KafkaProducer) sendFields(msgMap map[string]interface{},
+	funcs *kafkaFuncs) error {
+
+	var err error
+
+	// the first matching route may drop the record or change topic and key
+	topic := kp.config.Topic
+	keyType := kp.config.Key
+	keyName := kp.config.KeyName
+	if route := kp.route(msgMap); route != nil {
+		if route.Drop {
+			return nil
+		}
+		if route.Topic != "" {
+			topic = route.Topic
+		}
+		if route.Key != "" {
+			keyType = route.Key
+		}
+		if route.KeyName != "" {
+			keyName = route.KeyName
+		}
+	}
 
-	// capture topic if passed else use default
-	topic, ok := msgMap[TopicKey]
-	if ok {
+	// capture topic if passed, overrides default and route
+	if value, ok := msgMap[TopicKey]; ok {
 		delete(msgMap, TopicKey)
-	} else {
-		topic = kp.config.Topic
+		if name, ok := value.(string); ok {
+			topic = name
+		}
 	}
 
 	// get kafka key, may delete key from map
 	var key sarama.Encoder
-	err = kp.getKey(msgMap, &key)
+	var keyFn KeyFunc
+	if funcs != nil {
+		keyFn = funcs.keyFn
+	}
+	err = kp.getKey(msgMap, keyType, keyName, keyFn, &key)
 	if err != nil {
 		return err
 	}
 
-	// filter function performs field manipulation
-	if kp.config.filterFn != nil {
-		kp.config.filterFn(&msgMap)
+	// filter functions perform field manipulation
+	if funcs != nil {
+		for _, filterFn := range funcs.filters {
+			filterFn(&msgMap)
+		}
 	}
 
 	// add cloudevents fields like id (possibly dependent of message)
@@ -278,16 +918,97 @@ func (kp *KafkaProducer) sendMessage(msg []byte) error {
 		}
 	}
 
+	// promote fields to headers after all field manipulation
+	fieldHeaders := kp.fieldHeaders(msgMap)
+
+	// binary content mode moves cloudevents attributes to headers
+	if kp.ceBinary {
+		headers, data, err := kp.binaryMessage(msgMap)
+		if err != nil {
+			return err
+		}
+		return kp.inputMessage(&sarama.ProducerMessage{
+			Key:     key,
+			Topic:   topic,
+			Value:   sarama.ByteEncoder(data),
+			Headers: append(headers, fieldHeaders...),
+		})
+	}
+
 	// re-marshal message after field manipulation
 	newmsg, err := json.Marshal(msgMap)
 	if err != nil {
 		return err
 	}
 
-	kp.producer.Input() <- &sarama.ProducerMessage{
-		Key:   key,
-		Topic: topic.(string),
-		Value: sarama.ByteEncoder(newmsg),
+	return kp.inputMessage(&sarama.ProducerMessage{
+		Key:     key,
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(newmsg),
+		Headers: append(traceHeaders(msgMap), fieldHeaders...),
+	})
+}
+
+// fieldHeaders returns a header for each of the header fields in the message
+// named by the field, values that are not strings are written as in logfmt
+// fields are removed from the message if RemoveHeaders is set
+func (kp *KafkaProducer) fieldHeaders(
+	msgMap map[string]interface{}) []sarama.RecordHeader {
+
+	var headers []sarama.RecordHeader
+	for _, name := range kp.config.HeaderFields {
+		value, ok := msgMap[name]
+		if !ok {
+			continue
+		}
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(name),
+			Value: []byte(logfmtString(value)),
+		})
+		if kp.config.RemoveHeaders {
+			delete(msgMap, name)
+		}
+	}
+	return headers
+}
+
+// traceHeaders returns the distributed tracing headers for the message
+// binary content mode sends them as ce_ prefixed attribute headers instead
+func traceHeaders(msgMap map[string]interface{}) []sarama.RecordHeader {
+	var headers []sarama.RecordHeader
+	for _, key := range []string{CETraceParentKey, CETraceStateKey} {
+		if value, ok := msgMap[key].(string); ok {
+			headers = append(headers, sarama.RecordHeader{
+				Key:   []byte(key),
+				Value: []byte(value),
+			})
+		}
 	}
-	return nil
+	return headers
+}
+
+// binaryMessage returns the headers and body for cloudevents binary mode
+// attributes are prefixed with ce_ and the data content type is content-type
+func (kp *KafkaProducer) binaryMessage(msgMap map[string]interface{}) (
+	[]sarama.RecordHeader, []byte, error) {
+
+	attributes, data, contentType, err := kp.cloudEvents.ceBinaryFields(msgMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers := make([]sarama.RecordHeader, 0, len(attributes)+1)
+	for _, attribute := range attributes {
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(CEHeaderPrefix + attribute.name),
+			Value: []byte(attribute.value),
+		})
+	}
+	if contentType != "" {
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(ContentTypeHeader),
+			Value: []byte(contentType),
+		})
+	}
+	return headers, data, nil
 }
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// levelPayload provides the JSON body for the level handler
+type levelPayload struct {
+	Level LevelType `json:"level"`
+}
+
+// levelError provides the JSON error body for the level handler
+type levelError struct {
+	Error string `json:"error"`
+}
+
+// parseLevel returns the log level matching name, ignoring case
+func parseLevel(name string) (LevelType, error) {
+	level := LevelType(strings.ToLower(name))
+	switch level {
+	case DebugType, InfoType, WarnType, ErrorType, FatalType, PanicType:
+		return level, nil
+	default:
+		return "", fmt.Errorf("Invalid LogLevel type: %s", name)
+	}
+}
+
+// LevelHandler returns an http.Handler to get and set the log level
+// GET returns {"level":"info"}, PUT accepts the same body to change the level
+func LevelHandler(log Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var payload levelPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				enc.Encode(levelError{fmt.Sprintf("Invalid request body: %s",
+					err.Error())})
+				return
+			}
+			level, err := parseLevel(string(payload.Level))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				enc.Encode(levelError{err.Error()})
+				return
+			}
+			log.SetLevel(level)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			enc.Encode(levelError{fmt.Sprintf("Method not allowed: %s",
+				r.Method)})
+			return
+		}
+		enc.Encode(levelPayload{log.GetLevel()})
+	})
+}
@@ -0,0 +1,272 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// sinkCloser is implemented by sinks that must be flushed and released
+type sinkCloser interface {
+	Sync() error
+	closeContext(ctx context.Context) error
+}
+
+// fileSink wraps a log file or rotation logger so it can be synced and closed
+type fileSink struct {
+	io.Writer
+}
+
+// Sync commits the file to disk, rotation loggers do not buffer
+func (fs fileSink) Sync() error {
+	if syncer, ok := fs.Writer.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// sharedFiles holds the log files in use by path, shared by their loggers
+var sharedFiles = struct {
+	sync.Mutex
+	open map[string]*sharedFile
+}{open: make(map[string]*sharedFile)}
+
+// sharedFile provides a log file or rotation logger used by several loggers
+type sharedFile struct {
+	mut      sync.Mutex
+	path     string
+	writer   io.Writer              // *os.File or rotation logger
+	rotation *RotationConfiguration // nil without rotation
+	refs     int                    // guarded by sharedFiles
+}
+
+// sharedFileWriter provides the writer of one logger to a shared file
+type sharedFileWriter struct {
+	file   *sharedFile
+	closed int32 // Nonzero if closed, must access atomically
+}
+
+// openSharedFile returns a writer to the file at path, the file is opened
+// unless it is in use, if the rotation settings differ from those it was
+// opened with it is reopened with the new settings for all its writers
+func openSharedFile(path string,
+	rotation *RotationConfiguration) (*sharedFileWriter, error) {
+
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sharedFiles.Lock()
+	defer sharedFiles.Unlock()
+
+	if file, ok := sharedFiles.open[path]; ok {
+		if err := file.reopen(rotation); err != nil {
+			return nil, err
+		}
+		file.refs++
+		return &sharedFileWriter{file: file}, nil
+	}
+
+	file := &sharedFile{path: path}
+	if err := file.reopen(rotation); err != nil {
+		return nil, err
+	}
+	file.refs = 1
+	sharedFiles.open[path] = file
+	return &sharedFileWriter{file: file}, nil
+}
+
+// reopen opens the file with the rotation settings if they have changed
+func (sf *sharedFile) reopen(rotation *RotationConfiguration) error {
+	sf.mut.Lock()
+	defer sf.mut.Unlock()
+
+	if sf.writer != nil && reflect.DeepEqual(sf.rotation, rotation) {
+		return nil
+	}
+	var writer io.Writer
+	if rotation != nil {
+		writer = rotationLogger(sf.path, *rotation)
+	} else {
+		file, err := os.OpenFile(sf.path,
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		writer = file
+	}
+	if sf.writer != nil {
+		sf.close()
+	}
+	sf.writer = writer
+	sf.rotation = rotation
+	return nil
+}
+
+// close syncs and closes the file, must be called with the mutex held
+func (sf *sharedFile) close() error {
+	var err error
+	if file, ok := sf.writer.(*os.File); ok {
+		err = file.Sync()
+	}
+	if closer, ok := sf.writer.(io.Closer); ok {
+		if cerr := closer.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Write meets the interface for the io writer
+func (sw *sharedFileWriter) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&sw.closed) != 0 {
+		return 0, os.ErrClosed
+	}
+	sw.file.mut.Lock()
+	defer sw.file.mut.Unlock()
+	return sw.file.writer.Write(p)
+}
+
+// Sync commits the file to disk, rotation loggers do not buffer
+func (sw *sharedFileWriter) Sync() error {
+	sw.file.mut.Lock()
+	defer sw.file.mut.Unlock()
+	if file, ok := sw.file.writer.(*os.File); ok {
+		return file.Sync()
+	}
+	return nil
+}
+
+// Close releases the file, it is closed once it has no writers left
+func (sw *sharedFileWriter) Close() error {
+	if !atomic.CompareAndSwapInt32(&sw.closed, 0, 1) {
+		return nil
+	}
+	sharedFiles.Lock()
+	defer sharedFiles.Unlock()
+
+	sw.file.refs--
+	if sw.file.refs > 0 {
+		return nil
+	}
+	delete(sharedFiles.open, sw.file.path)
+	sw.file.mut.Lock()
+	defer sw.file.mut.Unlock()
+	return sw.file.close()
+}
+
+// closeContext syncs and closes the file
+func (fs fileSink) closeContext(ctx context.Context) error {
+	err := fs.Sync()
+	if closer, ok := fs.Writer.(io.Closer); ok {
+		if cerr := closer.Close(); cerr != nil {
+			return cerr
+		}
+	}
+	return err
+}
+
+// logSinks holds the sinks shared by a logger and the loggers derived from it
+type logSinks struct {
+	sinks     []sinkCloser
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// add registers a sink, sinks are closed in the order they are added
+func (ls *logSinks) add(sink sinkCloser) {
+	ls.sinks = append(ls.sinks, sink)
+}
+
+// sync flushes every sink and returns the errors encountered
+func (ls *logSinks) sync() error {
+	var errs []error
+	for _, sink := range ls.sinks {
+		if err := sink.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// abort releases the sinks opened before another sink failed to open
+// returns err so constructors can return it
+func (ls *logSinks) abort(err error) error {
+	ls.close(context.Background())
+	return err
+}
+
+// close flushes and releases every sink, only the first call has any effect
+func (ls *logSinks) close(ctx context.Context) error {
+	ls.closeOnce.Do(func() {
+		var errs []error
+		for _, sink := range ls.sinks {
+			if err := sink.closeContext(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		ls.closeErr = errors.Join(errs...)
+	})
+	return ls.closeErr
+}
+
+// pendingWrites counts writes in progress so a wait returns once the writes
+// started before it are done, unlike with a sync.WaitGroup writers may keep
+// starting writes while a wait is in progress
+type pendingWrites struct {
+	mut    sync.Mutex
+	cond   *sync.Cond     // broadcast when the writes of an epoch are done
+	epoch  uint64         // incremented by each wait
+	counts map[uint64]int // writes in progress by epoch
+}
+
+// start records a write in progress, returns the epoch to pass to done
+func (pw *pendingWrites) start() uint64 {
+	pw.mut.Lock()
+	defer pw.mut.Unlock()
+
+	if pw.counts == nil {
+		pw.counts = make(map[uint64]int)
+		pw.cond = sync.NewCond(&pw.mut)
+	}
+	pw.counts[pw.epoch]++
+	return pw.epoch
+}
+
+// done records the end of a write started in epoch
+func (pw *pendingWrites) done(epoch uint64) {
+	pw.mut.Lock()
+	defer pw.mut.Unlock()
+
+	pw.counts[epoch]--
+	if pw.counts[epoch] == 0 {
+		delete(pw.counts, epoch)
+		pw.cond.Broadcast()
+	}
+}
+
+// wait returns once the writes started before the call are done
+func (pw *pendingWrites) wait() {
+	pw.mut.Lock()
+	defer pw.mut.Unlock()
+
+	epoch := pw.epoch
+	pw.epoch++
+	for pw.busy(epoch) {
+		pw.cond.Wait()
+	}
+}
+
+// busy returns true if writes started in epoch or earlier are in progress
+func (pw *pendingWrites) busy(epoch uint64) bool {
+	for started := range pw.counts {
+		if started <= epoch {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Keys for logfmt fields, fields with the same keys are not written
+const (
+	LogfmtTimeKey    = "time"
+	LogfmtLevelKey   = "level"
+	LogfmtMessageKey = "msg"
+)
+
+// logfmtPool provides the buffers of zap logfmt records
+var logfmtPool = buffer.NewPool()
+
+// appendLogfmt appends a logfmt record shared by the zap and logrus formats
+// time (if enabled), level and msg are followed by the fields sorted by key
+// Example: time=2006-01-02T15:04:05Z level=warn msg="disk full" free=0
+func appendLogfmt(b []byte, t time.Time, timestamps bool, level LevelType,
+	msg string, fields map[string]interface{}) []byte {
+
+	if timestamps {
+		b = append(b, LogfmtTimeKey+"="...)
+		b = append(b, t.Format(time.RFC3339)...)
+		b = append(b, ' ')
+	}
+	b = append(b, LogfmtLevelKey+"="...)
+	b = append(b, level...)
+	b = append(b, " "+LogfmtMessageKey+"="...)
+	b = appendLogfmtValue(b, msg)
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		switch key {
+		case LogfmtTimeKey, LogfmtLevelKey, LogfmtMessageKey:
+		default:
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b = append(b, ' ')
+		b = appendLogfmtKey(b, key)
+		b = append(b, '=')
+		b = appendLogfmtValue(b, logfmtString(fields[key]))
+	}
+	return append(b, '\n')
+}
+
+// appendLogfmtKey appends a key, characters not allowed in keys become _
+func appendLogfmtKey(b []byte, key string) []byte {
+	if key == "" {
+		return append(b, '_')
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError ||
+			!strconv.IsPrint(r) {
+			r = '_'
+		}
+		b = append(b, string(r)...)
+	}
+	return b
+}
+
+// appendLogfmtValue appends a value, quoted and escaped if needed
+func appendLogfmtValue(b []byte, value string) []byte {
+	if value == "" {
+		return append(b, `""`...)
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' ||
+			r == utf8.RuneError || !strconv.IsPrint(r) {
+			return strconv.AppendQuote(b, value)
+		}
+	}
+	return append(b, value...)
+}
+
+// logfmtString returns the string form of a field value
+// zap and logrus pass fields differently, e.g. int64 or int and
+// errors as strings or errors, so both must result in the same string
+// values other than these types are written as JSON
+func logfmtString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32,
+		uint64, uintptr, float32, float64, complex64, complex128:
+		return fmt.Sprint(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+// logfmtEncoder provides a zap encoder for logfmt records
+// fields are collected in a map so they can be sorted like logrus fields
+type logfmtEncoder struct {
+	*zapcore.MapObjectEncoder
+	timestamps bool
+}
+
+// newLogfmtEncoder returns a logfmt encoder
+func newLogfmtEncoder(config LoggerConfiguration) zapcore.Encoder {
+	return &logfmtEncoder{
+		zapcore.NewMapObjectEncoder(),
+		config.EnableTimeStamps,
+	}
+}
+
+// Clone meets the interface for the zapcore encoder
+func (le *logfmtEncoder) Clone() zapcore.Encoder {
+	clone := zapcore.NewMapObjectEncoder()
+	for key, value := range le.Fields {
+		clone.Fields[key] = value
+	}
+	return &logfmtEncoder{clone, le.timestamps}
+}
+
+// EncodeEntry meets the interface for the zapcore encoder
+func (le *logfmtEncoder) EncodeEntry(entry zapcore.Entry,
+	fields []zapcore.Field) (*buffer.Buffer, error) {
+	enc := le.Clone().(*logfmtEncoder)
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	buf := logfmtPool.Get()
+	buf.Write(appendLogfmt(nil, entry.Time, le.timestamps,
+		getLevelType(entry.Level), entry.Message, enc.Fields))
+	return buf, nil
+}
+
+// logfmtFormatter provides a logrus formatter for logfmt records
+type logfmtFormatter struct {
+	timestamps bool
+}
+
+// newLogfmtFormatter returns a logfmt formatter
+func newLogfmtFormatter(config LoggerConfiguration) logrus.Formatter {
+	return &logfmtFormatter{config.EnableTimeStamps}
+}
+
+// Format meets the interface for the logrus formatter
+func (lf *logfmtFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return appendLogfmt(nil, entry.Time, lf.timestamps,
+		getLogrusLevelType(entry.Level), entry.Message, entry.Data), nil
+}
@@ -2,6 +2,12 @@
 
 package logger
 
+import (
+	"context"
+	"io"
+	"os"
+)
+
 // LogFields provided for calls to WithFields for structured logging
 type LogFields map[string]interface{}
 
@@ -12,6 +18,7 @@ type PackageType string
 const (
 	ZapType    PackageType = "zap"
 	LogrusType PackageType = "logrus"
+	SlogType   PackageType = "slog" // console, file and kafka sinks only
 )
 
 // LevelType provided to select log level
@@ -32,9 +39,12 @@ type FormatType string
 
 // Types of logger formats
 const (
-	JSONFormat FormatType = "json"
-	TextFormat FormatType = "text" // default
-	CEFormat   FormatType = "cloudevents"
+	JSONFormat   FormatType = "json"
+	TextFormat   FormatType = "text" // default
+	CEFormat     FormatType = "cloudevents"
+	ECSFormat    FormatType = "ecs"    // elastic common schema
+	GELFFormat   FormatType = "gelf"   // graylog extended log format
+	LogfmtFormat FormatType = "logfmt" // key=value, same for zap and logrus
 )
 
 // ConsoleType provided to select logger format
@@ -52,19 +62,45 @@ type LoggerConfiguration struct {
 	LogLevel          LevelType
 	EnableTimeStamps  bool
 	EnableColorLevels bool
+	ServiceName       string // defaults to the program name
 	EnableCloudEvents bool
 	CloudEventsCfg    CloudEventsConfiguration
 	EnableKafka       bool
 	KafkaFormat       FormatType
+	KafkaLevel        LevelType // defaults to LogLevel
 	KafkaProducerCfg  ProducerConfiguration
 	EnableConsole     bool
 	ConsoleFormat     FormatType
+	ConsoleLevel      LevelType // defaults to LogLevel
 	ConsoleWriter     ConsoleType
 	EnableFile        bool
 	FileFormat        FormatType
+	FileLevel         LevelType // defaults to LogLevel
 	FileLocation      string
 	EnableRotation    bool
 	RotationCfg       RotationConfiguration
+	EnableSyslog      bool
+	SyslogLevel       LevelType // defaults to LogLevel
+	SyslogCfg         SyslogConfiguration
+	EnableHTTP        bool
+	HTTPFormat        FormatType // json, ecs or cloudevents
+	HTTPLevel         LevelType  // defaults to LogLevel
+	HTTPCfg           HTTPConfiguration
+	EnableLoki        bool
+	LokiFormat        FormatType
+	LokiLevel         LevelType // defaults to LogLevel
+	LokiCfg           LokiConfiguration
+	EnableElastic     bool
+	ElasticFormat     FormatType // ecs or json
+	ElasticLevel      LevelType  // defaults to LogLevel
+	ElasticCfg        ElasticConfiguration
+	EnableGELF        bool
+	GELFLevel         LevelType         // defaults to LogLevel
+	GELFCfg           GELFConfiguration // also used by GELFFormat
+	EnableOTLP        bool
+	OTLPLevel         LevelType // defaults to LogLevel
+	OTLPCfg           OTLPConfiguration
+	ReloadMode        reloadType
 	EnableDebug       bool
 }
 
@@ -74,9 +110,19 @@ func NewLogger(config LoggerConfiguration) (Logger, error) {
 	if err != nil {
 		return nil, err
 	}
+	if config.ReloadMode != ReloadNone && config.ReloadMode != "" {
+		return newReloadLogger(config)
+	}
+	return newPackageLogger(config)
+}
+
+// newPackageLogger returns a Logger instance of the configured package
+func newPackageLogger(config LoggerConfiguration) (Logger, error) {
 	switch config.LogPackage {
 	case LogrusType:
 		return newLogrusLogger(config)
+	case SlogType:
+		return newSlogLogger(config)
 	case ZapType:
 		fallthrough
 	default:
@@ -84,6 +130,50 @@ func NewLogger(config LoggerConfiguration) (Logger, error) {
 	}
 }
 
+// getConsoleWriter returns the writer for console output
+func getConsoleWriter(config LoggerConfiguration) io.Writer {
+	if debugCapture != nil {
+		return debugCapture
+	} else if config.ConsoleWriter == Stderr {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// getFileWriter opens the log file, using a rotation logger if enabled
+// loggers writing to the same file share it
+func getFileWriter(config LoggerConfiguration) (io.Writer, error) {
+	fileLocation := config.FileLocation
+	if fileLocation == "" {
+		fileLocation = defaultLoggerConfiguration.FileLocation
+	}
+	var rotation *RotationConfiguration
+	if config.EnableRotation {
+		rotation = &config.RotationCfg
+	}
+	writer, err := openSharedFile(fileLocation, rotation)
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// getFallbackWriter returns the sink for undeliverable kafka messages
+func getFallbackWriter(config LoggerConfiguration,
+	fwriter io.Writer) io.Writer {
+
+	switch config.KafkaProducerCfg.Fallback {
+	case FallbackConsole:
+		return getConsoleWriter(config)
+	case FallbackFile:
+		return fwriter
+	case FallbackNone:
+		fallthrough
+	default:
+		return nil
+	}
+}
+
 // Logger is the contract for the logger interface
 type Logger interface {
 	Print(args ...interface{})
@@ -128,9 +218,33 @@ type Logger interface {
 
 	Panicln(args ...interface{})
 
+	Debugw(msg string, keysAndValues ...interface{})
+
+	Infow(msg string, keysAndValues ...interface{})
+
+	Warnw(msg string, keysAndValues ...interface{})
+
+	Errorw(msg string, keysAndValues ...interface{})
+
+	Fatalw(msg string, keysAndValues ...interface{})
+
+	Panicw(msg string, keysAndValues ...interface{})
+
 	WithFields(keyValues LogFields) Logger
 
+	WithContext(ctx context.Context) Logger
+
+	SetLevel(level LevelType)
+
+	GetLevel() LevelType
+
 	WithKafkaFilterFn(filter FilterFunc) Logger
 
 	WithKafkaKeyFn(filter KeyFunc) Logger
+
+	KafkaStats() ProducerStats
+
+	Sync() error
+
+	Close(ctx context.Context) error
 }
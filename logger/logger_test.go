@@ -3,22 +3,57 @@ package logger
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
 	cluster "github.com/bsm/sarama-cluster"
+	"github.com/golang/snappy"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 	"gopkg.in/yaml.v2"
 )
 
@@ -166,6 +201,18 @@ func executeTests(t *testing.T, cfg LoggerConfiguration) error {
 	log.Print("Print using", cfg.LogPackage)
 	log.Printf("Printf using %s", cfg.LogPackage)
 	log.Println("Println using", cfg.LogPackage)
+	return closeLogger(t, cfg, log)
+}
+
+func closeLogger(t *testing.T, cfg LoggerConfiguration, log Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := log.Close(ctx)
+	if err != nil {
+		t.Errorf("Failed to close %s logger: %s", cfg.LogPackage, err.Error())
+		return err
+	}
 	return nil
 }
 
@@ -177,7 +224,11 @@ func executeInitTests(t *testing.T, cfg LoggerConfiguration) error {
 	Print("Print using", cfg.LogPackage)
 	Printf("Printf using %s", cfg.LogPackage)
 	Println("Println using", cfg.LogPackage)
-	return nil
+	err := Sync()
+	if err != nil {
+		t.Errorf("Failed to sync %s logger: %s", cfg.LogPackage, err.Error())
+	}
+	return err
 }
 
 func executeTopicTests(t *testing.T, cfg LoggerConfiguration,
@@ -197,7 +248,7 @@ func executeTopicTests(t *testing.T, cfg LoggerConfiguration,
 	log.WithFields(topicfield).Print("Print using", cfg.LogPackage)
 	log.WithFields(topicfield).Printf("Printf using %s", cfg.LogPackage)
 	log.WithFields(topicfield).Println("Println using", cfg.LogPackage)
-	return nil
+	return closeLogger(t, cfg, log)
 }
 
 func normalizeJSONFile(t *testing.T, filename string) ([]byte, error) {
@@ -314,9 +365,11 @@ func setupConsole(t *testing.T, name string, pkg string,
 
 func checkConsole(t *testing.T, name string, pkg string,
 	cfg LoggerConfiguration, output *os.File) {
-	var containsUnsortedJSON bool
 	var err error
 
+	// cloudevents fields are not in a fixed order
+	containsUnsortedJSON := cfg.ConsoleFormat == CEFormat
+
 	if output != nil {
 		if cfg.ConsoleWriter == Stderr {
 			os.Stderr.Close()
@@ -518,26 +571,38 @@ func testHarness(t *testing.T, name string, prefix string, pkg string,
 
 	cfg := getConfiguration(t, name, prefix)
 
+	// each sink has its own golden file when several are tested together
+	conName, logName, pubName := name, name, name
+	sinks := 0
+	for _, enabled := range []bool{console, logfile, pubsub} {
+		if enabled {
+			sinks++
+		}
+	}
+	if sinks > 1 {
+		conName, logName, pubName = name+tCon, name+tLog, name+tPub
+	}
+
 	if console {
-		conOutput = setupConsole(t, name, pkg, cfg)
+		conOutput = setupConsole(t, conName, pkg, cfg)
 	}
 	if logfile {
-		logOutput = setupLogfile(t, name, pkg, cfg)
+		logOutput = setupLogfile(t, logName, pkg, cfg)
 	}
 	if pubsub {
-		setupPubsub(t, name, pkg, cfg)
+		setupPubsub(t, pubName, pkg, cfg)
 	}
 
 	runTests(t, name, pkg, cfg)
 
 	if console {
-		checkConsole(t, name, pkg, cfg, conOutput)
+		checkConsole(t, conName, pkg, cfg, conOutput)
 	}
 	if logfile {
-		checkLogfile(t, name, pkg, cfg, logOutput)
+		checkLogfile(t, logName, pkg, cfg, logOutput)
 	}
 	if pubsub {
-		checkPubsub(t, name, pkg, cfg)
+		checkPubsub(t, pubName, pkg, cfg)
 	}
 }
 
@@ -583,6 +648,10 @@ func TestConsole(t *testing.T) {
 			"logrus logger to console with default config"},
 		{tNil, tZap, tCon, tNil, tNil, "Default",
 			"zap logger to console with default config"},
+		{tNil, tLru, tCon, tNil, tNil, "Logfmt",
+			"logrus logger to console with logfmt format"},
+		{tNil, tZap, tCon, tNil, tNil, "Logfmt",
+			"zap logger to console with logfmt format"},
 	}
 	if testinit || testenv {
 		t.SkipNow()
@@ -603,6 +672,23 @@ func TestLogfile(t *testing.T) {
 	runTestCases(t, testCases)
 }
 
+func TestConsoleLogfile(t *testing.T) {
+	var testCases = []TestCases{
+		{tNil, tLru, tCon, tLog, tNil, "Default",
+			"logrus logger to console and file with default config"},
+		{tNil, tZap, tCon, tLog, tNil, "Default",
+			"zap logger to console and file with default config"},
+		{tNil, tLru, tCon, tLog, tNil, "CloudEvents",
+			"logrus logger to console and file with cloudevents format"},
+		{tNil, tZap, tCon, tLog, tNil, "CloudEvents",
+			"zap logger to console and file with cloudevents format"},
+	}
+	if testinit || testenv {
+		t.SkipNow()
+	}
+	runTestCases(t, testCases)
+}
+
 func TestPubsub(t *testing.T) {
 	var testCases = []TestCases{
 		{tNil, tLru, tNil, tNil, tPub, "Default",
@@ -653,3 +739,2629 @@ func TestInit(t *testing.T) {
 	}
 	runTestCases(t, testCases)
 }
+
+func TestKafkaDelivery(t *testing.T) {
+	var handled []byte
+	var fallback bytes.Buffer
+
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, config)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	kp := &KafkaProducer{
+		producer: producer,
+		config:   DefaultProducerCfg(),
+		levelKey: "level",
+		fallback: &fallback,
+		done:     make(chan struct{}),
+	}
+	kp.config.ErrorHandler = func(topic string, msg []byte, err error) {
+		handled = msg
+	}
+	kp.startReaders()
+
+	messages := []string{
+		`{"level":"info","msg":"acked"}`,
+		`{"level":"error","msg":"failed"}`,
+	}
+	for _, msg := range messages {
+		if err := kp.sendMessage([]byte(msg), nil); err != nil {
+			t.Fatalf("Failed to send message %s: %s\n", msg, err.Error())
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := kp.close(ctx); err != nil {
+		t.Errorf("Failed to close producer: %s\n", err.Error())
+	}
+
+	expected := ProducerStats{Sent: 2, Acked: 1, Failed: 1, Dropped: 0}
+	if stats := kp.Stats(); stats != expected {
+		t.Errorf("Producer stats %+v, expected %+v\n", stats, expected)
+	}
+	if string(handled) != messages[1] {
+		t.Errorf("Error handler got <%s>, expected <%s>\n", handled,
+			messages[1])
+	}
+	if fallback.String() != messages[1]+"\n" {
+		t.Errorf("Fallback got <%s>, expected <%s>\n", fallback.String(),
+			messages[1])
+	}
+}
+
+func TestKafkaSpool(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	messages := []string{
+		`{"id":"00000000000000000001","level":"info","msg":"failed"}`,
+		`{"id":"00000000000000000002","level":"info","msg":"spooled"}`,
+	}
+	checker := func(expected string) mocks.ValueChecker {
+		return func(val []byte) error {
+			if string(val) != expected {
+				return fmt.Errorf("replayed <%s>, expected <%s>", val, expected)
+			}
+			return nil
+		}
+	}
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, config)
+	producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+	producer.ExpectInputWithCheckerFunctionAndSucceed(checker(messages[0]))
+	producer.ExpectInputWithCheckerFunctionAndSucceed(checker(messages[1]))
+
+	spoolCfg := SpoolConfiguration{Directory: t.TempDir(), ReplayFreq: time.Hour}
+	spool, err := openKafkaSpool(spoolCfg)
+	if err != nil {
+		t.Fatalf("Failed to create spool: %s\n", err.Error())
+	}
+
+	kp := &KafkaProducer{
+		producer:   producer,
+		config:     DefaultProducerCfg(),
+		levelKey:   "level",
+		spool:      spool,
+		healthy:    1,
+		done:       make(chan struct{}),
+		stopReplay: make(chan struct{}),
+		replayDone: make(chan struct{}),
+	}
+	kp.config.ErrorHandler = func(topic string, msg []byte, err error) {}
+	kp.startReaders()
+	go kp.replaySpool()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// first message fails and is spooled, second is spooled as unhealthy
+	for _, msg := range messages {
+		if err := kp.sendMessage([]byte(msg), nil); err != nil {
+			t.Fatalf("Failed to send message %s: %s\n", msg, err.Error())
+		}
+		if err := kp.flush(ctx); err != nil {
+			t.Fatalf("Failed to flush producer: %s\n", err.Error())
+		}
+	}
+	if spool.empty() {
+		t.Fatalf("Spool is empty before replay\n")
+	}
+
+	if !kp.replaySegment() {
+		t.Errorf("Failed to replay spool segment\n")
+	}
+	if !spool.empty() {
+		t.Errorf("Spool is not empty after replay\n")
+	}
+
+	if err := kp.close(ctx); err != nil {
+		t.Errorf("Failed to close producer: %s\n", err.Error())
+	}
+
+	expected := ProducerStats{Sent: 1, Failed: 1, Spooled: 2, Replayed: 2}
+	if stats := kp.Stats(); stats != expected {
+		t.Errorf("Producer stats %+v, expected %+v\n", stats, expected)
+	}
+
+	// records the full spool does not take go to the fallback or are dropped
+	full, err := openKafkaSpool(SpoolConfiguration{
+		Directory: t.TempDir(),
+		MaxBytes:  1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create spool: %s\n", err.Error())
+	}
+	defer full.release()
+	var fallback bytes.Buffer
+	kp = &KafkaProducer{config: DefaultProducerCfg(), spool: full}
+	kp.setFallback(&fallback)
+	if err := kp.sendMessage([]byte(messages[0]), nil); err != nil {
+		t.Errorf("Failed to write to fallback: %s\n", err.Error())
+	}
+	kp.setFallback(nil)
+	if err := kp.sendMessage([]byte(messages[1]), nil); err != errSpoolFull {
+		t.Errorf("Dropped message error %v, expected %v\n", err,
+			errSpoolFull)
+	}
+	if stats := kp.Stats(); stats.Dropped != 1 ||
+		!strings.Contains(fallback.String(), "failed") {
+		t.Errorf("Producer stats %+v fallback %q\n", stats, fallback.String())
+	}
+}
+
+func TestCloudEventsBinary(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	ceConfig := DefaultCloudEventsCfg()
+	ceConfig.SetID = CEIncrID
+	ceConfig.Mode = CEBinary
+	kp := &KafkaProducer{
+		config:      DefaultProducerCfg(),
+		cloudEvents: newCloudEvents(ceConfig),
+		enableCE:    true,
+		ceBinary:    true,
+		levelKey:    CESubjectKey,
+	}
+
+	msgMap := map[string]interface{}{
+		CEDataKey:    "Infof using binary",
+		CESubjectKey: "info",
+		CETimeKey:    "2020-01-01T00:00:00Z",
+	}
+	for key, val := range kp.cloudEvents.fields {
+		msgMap[key] = val
+	}
+	if err := kp.cloudEvents.ceAddFields(msgMap); err != nil {
+		t.Fatalf("Failed to add cloudevents fields: %s\n", err.Error())
+	}
+
+	headers, data, err := kp.binaryMessage(msgMap)
+	if err != nil {
+		t.Fatalf("Failed to create binary message: %s\n", err.Error())
+	}
+	if string(data) != "Infof using binary" {
+		t.Errorf("Binary data <%s>, expected <Infof using binary>\n", data)
+	}
+
+	var actual []string
+	for _, header := range headers {
+		actual = append(actual, string(header.Key)+"="+string(header.Value))
+	}
+	expected := []string{
+		"ce_id=00000000000000000001",
+		"ce_source=" + ceConfig.Source,
+		"ce_specversion=1.0",
+		"ce_subject=info",
+		"ce_time=2020-01-01T00:00:00Z",
+		"ce_type=" + ceConfig.Type,
+		"content-type=text/plain; charset=utf-8",
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Binary headers %v, expected %v\n", actual, expected)
+	}
+
+	// fields that are not valid attribute names are kept in the data
+	msgMap["tenant"] = "t1"
+	msgMap["user_id"] = 7
+	headers, data, err = kp.binaryMessage(msgMap)
+	if err != nil {
+		t.Fatalf("Failed to create binary message: %s\n", err.Error())
+	}
+	expectedData := `{"data":"Infof using binary","user_id":7}`
+	if string(data) != expectedData {
+		t.Errorf("Binary data <%s>, expected <%s>\n", data, expectedData)
+	}
+	actual = nil
+	for _, header := range headers {
+		actual = append(actual, string(header.Key)+"="+string(header.Value))
+	}
+	expected = append(expected[:4], "ce_tenant=t1", expected[4],
+		"ce_type="+ceConfig.Type, "content-type=application/json")
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Binary headers %v, expected %v\n", actual, expected)
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate and its key as PEM
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka"},
+		DNSNames:              []string{"kafka"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err.Error())
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %s", err.Error())
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	for file, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := ioutil.WriteFile(file, pem.EncodeToMemory(block),
+			0600); err != nil {
+			t.Fatalf("Failed to write %s: %s", file, err.Error())
+		}
+	}
+	return certFile, keyFile
+}
+
+func TestKafkaAuth(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	// TLS files and SASL are read from the environment like other settings
+	certFile, keyFile := writeTestCertificate(t, t.TempDir())
+	for key, value := range map[string]string{
+		"ENABLETLS":     "true",
+		"TLSCAFILE":     certFile,
+		"TLSCERTFILE":   certFile,
+		"TLSKEYFILE":    keyFile,
+		"TLSSERVERNAME": "kafka",
+		"TLSMINVERSION": string(TLSVersion13),
+		"ENABLESASL":    "true",
+		"SASLMECHANISM": string(SASLSCRAMSHA512),
+		"SASLUSERNAME":  "user",
+		"SASLPASSWORD":  "pencil",
+	} {
+		t.Setenv(KafkaEnvPrefix+"_"+key, value)
+	}
+	cfg, err := GetLoggerConfiguration(EnvConfig, "")
+	if err != nil {
+		t.Fatalf("Failed to read configuration: %s", err.Error())
+	}
+	cfg.LogPackage = ZapType
+	cfg.EnableConsole = false
+
+	var saramaCfg *sarama.Config
+	saved := newAsyncProducer
+	t.Cleanup(func() { newAsyncProducer = saved })
+	newAsyncProducer = func(addrs []string,
+		config *sarama.Config) (sarama.AsyncProducer, error) {
+		saramaCfg = config
+		return mocks.NewAsyncProducer(t, config), nil
+	}
+	cfg.EnableKafka = true
+	log, err := NewLogger(cfg)
+	if err != nil {
+		t.Fatalf("Failed to instantiate logger: %s", err.Error())
+	}
+	closeLogger(t, cfg, log)
+
+	if err := saramaCfg.Validate(); err != nil {
+		t.Errorf("Invalid sarama configuration: %s\n", err.Error())
+	}
+	tlsCfg := saramaCfg.Net.TLS.Config
+	if !saramaCfg.Net.TLS.Enable || tlsCfg == nil ||
+		tlsCfg.ServerName != "kafka" || tlsCfg.MinVersion != tls.VersionTLS13 ||
+		tlsCfg.RootCAs == nil || len(tlsCfg.Certificates) != 1 {
+		t.Errorf("TLS configuration not applied: %+v\n", saramaCfg.Net.TLS)
+	}
+	sasl := saramaCfg.Net.SASL
+	if !sasl.Enable || sasl.Mechanism != sarama.SASLTypeSCRAMSHA512 ||
+		sasl.User != "user" || sasl.Password != "pencil" {
+		t.Errorf("SASL configuration not applied: %+v\n", sasl)
+	}
+
+	// RFC 7677 test vector for SCRAM-SHA-256
+	client := newSCRAMClient(sha256.New)
+	nonce := func() string { return "rOprNGfwEbeRWgbNEkqO" }
+	if err := client.Begin("user", "pencil", ""); err != nil {
+		t.Fatalf("Failed to begin SCRAM: %s", err.Error())
+	}
+	client.WithNonceGenerator(nonce)
+	serverNonce := nonce() + "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
+	for _, step := range []struct{ challenge, response string }{
+		{"", "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"},
+		{"r=" + serverNonce + ",s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			"c=biws,r=" + serverNonce +
+				",p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="},
+		{"v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=", ""},
+	} {
+		response, err := client.Step(step.challenge)
+		if err != nil {
+			t.Fatalf("SCRAM step failed: %s", err.Error())
+		}
+		if response != step.response {
+			t.Errorf("SCRAM response %s, expected %s\n", response,
+				step.response)
+		}
+	}
+	if !client.Done() {
+		t.Errorf("SCRAM exchange not done\n")
+	}
+
+	// a wrong server signature fails the exchange
+	client.Begin("user", "pencil", "")
+	client.WithNonceGenerator(nonce)
+	client.Step("")
+	client.Step("r=" + serverNonce + ",s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if _, err := client.Step("v=AAAA"); err == nil {
+		t.Errorf("SCRAM accepted a wrong server signature\n")
+	}
+
+	// missing files and credentials are configuration errors
+	cfg.KafkaProducerCfg.TLSKeyFile = ""
+	cfg.KafkaProducerCfg.TLSCAFile = filepath.Join(t.TempDir(), "none.pem")
+	cfg.KafkaProducerCfg.SASLPassword = ""
+	var errCount int
+	checkProducerConfig(cfg.KafkaProducerCfg, &errCount)
+	if errCount != 3 {
+		t.Errorf("Found %d configuration errors, expected 3\n", errCount)
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	var testCases = []struct {
+		method string
+		body   string
+		status int
+		level  LevelType
+	}{
+		{http.MethodGet, "", http.StatusOK, InfoType},
+		{http.MethodPut, `{"level":"debug"}`, http.StatusOK, DebugType},
+		{http.MethodPut, `{"level":"WARN"}`, http.StatusOK, WarnType},
+		{http.MethodPut, `{"level":"verbose"}`, http.StatusBadRequest, WarnType},
+		{http.MethodPut, `level=error`, http.StatusBadRequest, WarnType},
+		{http.MethodPost, "", http.StatusMethodNotAllowed, WarnType},
+	}
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		cfg := LoggerConfiguration{LogPackage: pkg, LogLevel: InfoType}
+		log, err := NewLogger(cfg)
+		if err != nil {
+			t.Fatalf("Failed to instantiate %s logger: %s", pkg, err.Error())
+		}
+		handler := LevelHandler(log)
+
+		for _, tc := range testCases {
+			req := httptest.NewRequest(tc.method, "/level",
+				strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("%s %s %s status %d, expected %d\n", pkg, tc.method,
+					tc.body, rec.Code, tc.status)
+			}
+			if level := log.GetLevel(); level != tc.level {
+				t.Errorf("%s %s %s level %s, expected %s\n", pkg, tc.method,
+					tc.body, level, tc.level)
+			}
+			if tc.status == http.StatusOK {
+				expected := fmt.Sprintf(`{"level":"%s"}`+"\n", tc.level)
+				if rec.Body.String() != expected {
+					t.Errorf("%s %s %s body %s, expected %s", pkg, tc.method,
+						tc.body, rec.Body.String(), expected)
+				}
+			}
+		}
+
+		// derived loggers share the level
+		derived := log.WithFields(LogFields{"key": "value"})
+		if level := derived.GetLevel(); level != WarnType {
+			t.Errorf("%s derived level %s, expected %s\n", pkg, level, WarnType)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv(ConfigTypeEnvName, string(FileConfig))
+	t.Setenv(ConfigFileEnvName, "pr_reload_config")
+	cfgFile := filepath.Join(dir, "pr_reload_config.yaml")
+	writeReloadConfig := func(level LevelType, location string) {
+		content := fmt.Sprintf("logpackage: zap\nloglevel: %s\n"+
+			"enableconsole: false\nenablefile: true\nfilelocation: %s\n",
+			level, location)
+		if err := ioutil.WriteFile(cfgFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", cfgFile, err.Error())
+		}
+	}
+
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "second.log")
+	writeReloadConfig(InfoType, first)
+	cfg, err := GetLoggerConfiguration(FileConfig, "pr_reload_config")
+	if err != nil {
+		t.Fatalf("Failed to read configuration: %s", err.Error())
+	}
+	cfg.ReloadMode = ReloadSignal
+	log, err := NewLogger(cfg)
+	if err != nil {
+		t.Fatalf("Failed to instantiate logger: %s", err.Error())
+	}
+	derived := log.WithFields(LogFields{"key": "value"})
+	derived.Info("before reload")
+
+	writeReloadConfig(DebugType, second)
+	if err = Reload(); err != nil {
+		t.Fatalf("Reload failed: %s", err.Error())
+	}
+	derived.Debug("after reload")
+	if level := log.GetLevel(); level != DebugType {
+		t.Errorf("Level after reload %s, expected %s\n", level, DebugType)
+	}
+
+	// an invalid config is rejected and the current config is kept
+	writeReloadConfig("verbose", first)
+	if err = Reload(); err == nil {
+		t.Errorf("Reload of invalid config did not fail\n")
+	}
+	derived.Info("after failed reload")
+
+	// a logger created from another config takes the config file settings
+	other, err := NewLogger(LoggerConfiguration{
+		LogPackage: ZapType,
+		LogLevel:   WarnType,
+		ReloadMode: ReloadSignal,
+	})
+	if err != nil {
+		t.Fatalf("Failed to instantiate logger: %s", err.Error())
+	}
+	writeReloadConfig(ErrorType, second)
+	if err = Reload(); err != nil {
+		t.Fatalf("Reload failed: %s", err.Error())
+	}
+	if level := other.GetLevel(); level != ErrorType {
+		t.Errorf("Level of other logger %s, expected %s\n", level, ErrorType)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err = log.Close(ctx); err != nil {
+		t.Errorf("Close failed: %s", err.Error())
+	}
+	other.Close(ctx)
+
+	for file, expected := range map[string][]string{
+		first:  {"before reload"},
+		second: {"after reload", "after failed reload"},
+	} {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %s", file, err.Error())
+		}
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		if len(lines) != len(expected) {
+			t.Fatalf("%s has %d lines, expected %d: %s", file, len(lines),
+				len(expected), content)
+		}
+		for i, line := range lines {
+			if !strings.Contains(line, expected[i]) ||
+				!strings.Contains(line, `"key":"value"`) {
+				t.Errorf("%s line %d is %s, expected %s with key", file, i,
+					line, expected[i])
+			}
+		}
+	}
+}
+
+// sinkOpen returns true if the file or spool directory at path is in use
+// the registries are locked as loggers replaced on reload close in the
+// background
+func sinkOpen(path string) bool {
+	sharedFiles.Lock()
+	_, file := sharedFiles.open[path]
+	sharedFiles.Unlock()
+	spools.Lock()
+	_, spool := spools.open[path]
+	spools.Unlock()
+	return file || spool
+}
+
+// TestSharedSinks checks loggers writing to the same file or spool
+// directory, as a logger and the logger replacing it on reload do, share it
+func TestSharedSinks(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	dir := t.TempDir()
+	cfg := LoggerConfiguration{FileLocation: filepath.Join(dir, "shared.log")}
+	first, err := getFileWriter(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open file: %s", err.Error())
+	}
+	cfg.EnableRotation = true
+	cfg.RotationCfg = RotationConfiguration{MaxSize: 1}
+	second, err := getFileWriter(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open file: %s", err.Error())
+	}
+	file := first.(*sharedFileWriter).file
+	if second.(*sharedFileWriter).file != file || file.refs != 2 ||
+		file.rotation == nil {
+		t.Fatalf("File not shared and reopened with rotation: %+v", file)
+	}
+	fmt.Fprintln(first, "first")
+	fileSink{first}.closeContext(context.Background())
+	fmt.Fprintln(first, "closed")
+	fmt.Fprintln(second, "second")
+	fileSink{second}.closeContext(context.Background())
+	if sinkOpen(cfg.FileLocation) {
+		t.Errorf("Closed file still open\n")
+	}
+	content, err := ioutil.ReadFile(cfg.FileLocation)
+	if err != nil || string(content) != "first\nsecond\n" {
+		t.Errorf("File content %q, expected first and second: %v\n",
+			content, err)
+	}
+
+	spoolCfg := SpoolConfiguration{Directory: filepath.Join(dir, "spool")}
+	spool, err := openKafkaSpool(spoolCfg)
+	if err != nil {
+		t.Fatalf("Failed to open spool: %s", err.Error())
+	}
+	spoolCfg.MaxBytes = 1024
+	replacing, err := openKafkaSpool(spoolCfg)
+	if err != nil {
+		t.Fatalf("Failed to open spool: %s", err.Error())
+	}
+	if replacing != spool || spool.refs != 2 ||
+		spool.config.MaxBytes != 1024 {
+		t.Fatalf("Spool not shared with the new config: %+v", spool)
+	}
+	spool.release()
+	if err = replacing.write(&spoolRecord{Topic: "logs"}); err != nil {
+		t.Errorf("Write to released spool failed: %s\n", err.Error())
+	}
+	replacing.release()
+	if sinkOpen(spoolCfg.Directory) {
+		t.Errorf("Released spool still open\n")
+	}
+}
+
+// mockKafkaLogger returns a logger whose kafka producer is a sarama mock
+// that expects count messages
+func mockKafkaLogger(t *testing.T, cfg LoggerConfiguration,
+	count int) (Logger, *recordingProducer) {
+
+	recorder := &recordingProducer{input: make(chan *sarama.ProducerMessage)}
+	saved := newAsyncProducer
+	t.Cleanup(func() { newAsyncProducer = saved })
+	newAsyncProducer = func(addrs []string,
+		config *sarama.Config) (sarama.AsyncProducer, error) {
+		recorder.AsyncProducer = mocks.NewAsyncProducer(t, config)
+		for i := 0; i < count; i++ {
+			recorder.ExpectInputAndSucceed()
+		}
+		go recorder.record()
+		return recorder, nil
+	}
+
+	cfg.EnableKafka = true
+	log, err := NewLogger(cfg)
+	if err != nil {
+		t.Fatalf("Failed to instantiate %s logger: %s", cfg.LogPackage,
+			err.Error())
+	}
+	return log, recorder
+}
+
+// recordingProducer keeps each message sent to the mock producer
+type recordingProducer struct {
+	*mocks.AsyncProducer
+	input    chan *sarama.ProducerMessage
+	messages []*sarama.ProducerMessage
+}
+
+// record forwards messages to the mock producer until input is closed
+func (rp *recordingProducer) record() {
+	for msg := range rp.input {
+		rp.messages = append(rp.messages, msg)
+		rp.AsyncProducer.Input() <- msg
+	}
+	rp.AsyncProducer.AsyncClose()
+}
+
+func (rp *recordingProducer) Input() chan<- *sarama.ProducerMessage {
+	return rp.input
+}
+
+func (rp *recordingProducer) AsyncClose() {
+	close(rp.input)
+}
+
+// values returns the recorded message values decoded as JSON
+func (rp *recordingProducer) values(t *testing.T) []map[string]interface{} {
+	var values []map[string]interface{}
+	for _, msg := range rp.messages {
+		var value map[string]interface{}
+		encoded, _ := msg.Value.Encode()
+		if err := json.Unmarshal(encoded, &value); err != nil {
+			t.Fatalf("Failed to decode kafka message %s: %s", encoded,
+				err.Error())
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestStructuredFields(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		var filtered []interface{}
+		cfg := LoggerConfiguration{
+			LogPackage:  pkg,
+			LogLevel:    InfoType,
+			KafkaFormat: JSONFormat,
+			KafkaProducerCfg: ProducerConfiguration{
+				Key: FunctionKey,
+			},
+		}
+		log, recorder := mockKafkaLogger(t, cfg, 2)
+		log = log.WithKafkaKeyFn(func(msg *map[string]interface{}) string {
+			return fmt.Sprint((*msg)["user"])
+		}).WithKafkaFilterFn(func(msg *map[string]interface{}) {
+			filtered = append(filtered, (*msg)["count"])
+		})
+
+		log.Infow("structured", "user", "alice", "count", 3)
+		log.WithFields(LogFields{"fixed": true}).Warnw("derived",
+			"user", "bob", "count", 4)
+		log.Debugw("filtered by level", "user", "carol")
+		closeLogger(t, cfg, log)
+
+		values := recorder.values(t)
+		if len(values) != 2 {
+			t.Fatalf("%s sent %d messages, expected 2", pkg, len(values))
+		}
+		for i, expected := range []struct {
+			key   string
+			count float64
+		}{{"alice", 3}, {"bob", 4}} {
+			key, _ := recorder.messages[i].Key.Encode()
+			if string(key) != expected.key {
+				t.Errorf("%s message %d key %s, expected %s\n", pkg, i, key,
+					expected.key)
+			}
+			if values[i]["user"] != expected.key ||
+				values[i]["count"] != expected.count {
+				t.Errorf("%s message %d fields %v\n", pkg, i, values[i])
+			}
+			// filters see native values, e.g. int64 rather than float64
+			if fmt.Sprint(filtered[i]) != fmt.Sprint(expected.count) {
+				t.Errorf("%s filter %d got count %v, expected %v\n", pkg, i,
+					filtered[i], expected.count)
+			}
+		}
+		if values[1]["fixed"] != true {
+			t.Errorf("%s derived message lost fixed field: %v\n", pkg,
+				values[1])
+		}
+	}
+}
+
+// ackProducer provides a sarama producer that encodes and acks every
+// message after a delay, benchmarks use no delay to measure the logger
+// rather than the mock
+type ackProducer struct {
+	delay     time.Duration
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+}
+
+// newAckProducer substitutes an ack producer for the sarama producer
+func newAckProducer(tb testing.TB, delay time.Duration) {
+	saved := newAsyncProducer
+	tb.Cleanup(func() { newAsyncProducer = saved })
+	newAsyncProducer = func(addrs []string,
+		config *sarama.Config) (sarama.AsyncProducer, error) {
+		ap := &ackProducer{
+			delay:     delay,
+			input:     make(chan *sarama.ProducerMessage, 256),
+			successes: make(chan *sarama.ProducerMessage, 256),
+			errors:    make(chan *sarama.ProducerError),
+		}
+		go func() {
+			for msg := range ap.input {
+				msg.Value.Encode()
+				time.Sleep(ap.delay)
+				ap.successes <- msg
+			}
+			close(ap.successes)
+			close(ap.errors)
+		}()
+		return ap, nil
+	}
+}
+
+func (ap *ackProducer) AsyncClose() {
+	close(ap.input)
+}
+
+func (ap *ackProducer) Close() error {
+	ap.AsyncClose()
+	return nil
+}
+
+func (ap *ackProducer) Input() chan<- *sarama.ProducerMessage {
+	return ap.input
+}
+
+func (ap *ackProducer) Successes() <-chan *sarama.ProducerMessage {
+	return ap.successes
+}
+
+func (ap *ackProducer) Errors() <-chan *sarama.ProducerError {
+	return ap.errors
+}
+
+// writeZapFatal writes a fatal record to the core of a zap logger
+// the core is written directly, the logger would call os.Exit
+func writeZapFatal(t *testing.T, log Logger) {
+	core := log.(*zapLogger).sugaredLogger.Desugar().Core()
+	entry := zapcore.Entry{
+		Level:   zapcore.FatalLevel,
+		Time:    time.Now(),
+		Message: "fatal",
+	}
+	if err := core.Write(entry, nil); err != nil {
+		t.Fatalf("Failed to write fatal record: %s", err.Error())
+	}
+}
+
+// TestKafkaFatalFlush checks a zap fatal record is acked before the core
+// returns, as zap exits right after writing it
+func TestKafkaFatalFlush(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	newAckProducer(t, 50*time.Millisecond)
+	cfg := LoggerConfiguration{
+		LogPackage:  ZapType,
+		LogLevel:    InfoType,
+		EnableKafka: true,
+		KafkaFormat: JSONFormat,
+	}
+	log, err := NewLogger(cfg)
+	if err != nil {
+		t.Fatalf("Failed to instantiate logger: %s", err.Error())
+	}
+	writeZapFatal(t, log)
+	if stats := log.KafkaStats(); stats.Sent != 1 || stats.Acked != 1 {
+		t.Errorf("Fatal record not flushed: %+v\n", stats)
+	}
+	closeLogger(t, cfg, log)
+
+	// the flush gives up after syncTimeout when records are not acked
+	newAckProducer(t, time.Second)
+	saved := syncTimeout
+	syncTimeout = 50 * time.Millisecond
+	defer func() { syncTimeout = saved }()
+	log, err = NewLogger(cfg)
+	if err != nil {
+		t.Fatalf("Failed to instantiate logger: %s", err.Error())
+	}
+	start := time.Now()
+	writeZapFatal(t, log)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Fatal record flush took %s\n", elapsed)
+	}
+	log.Info("not acked")
+	if err = log.Sync(); err == nil {
+		t.Errorf("Sync of records not acked did not fail\n")
+	}
+	closeLogger(t, cfg, log)
+}
+
+// TestKafkaSync checks Sync while other goroutines keep logging
+func TestKafkaSync(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	newAckProducer(t, 0)
+	for _, pkg := range []PackageType{ZapType, LogrusType} {
+		cfg := LoggerConfiguration{
+			LogPackage:  pkg,
+			LogLevel:    InfoType,
+			EnableKafka: true,
+			KafkaFormat: JSONFormat,
+		}
+		log, err := NewLogger(cfg)
+		if err != nil {
+			t.Fatalf("Failed to instantiate %s logger: %s", pkg, err.Error())
+		}
+		stop := make(chan struct{})
+		var writers sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			writers.Add(1)
+			go func() {
+				defer writers.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						log.Info("busy")
+					}
+				}
+			}()
+		}
+		for i := 0; i < 20; i++ {
+			log.Info("sync")
+			if err := log.Sync(); err != nil {
+				t.Errorf("%s Sync failed: %s", pkg, err.Error())
+			}
+		}
+		close(stop)
+		writers.Wait()
+		closeLogger(t, cfg, log)
+	}
+}
+
+func TestKafkaFuncsScope(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	setField := func(key string, value interface{}) FilterFunc {
+		return func(msg *map[string]interface{}) {
+			(*msg)[key] = value
+		}
+	}
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		cfg := LoggerConfiguration{
+			LogPackage:  pkg,
+			LogLevel:    InfoType,
+			KafkaFormat: JSONFormat,
+			KafkaProducerCfg: ProducerConfiguration{
+				Key: FunctionKey,
+			},
+		}
+		log, recorder := mockKafkaLogger(t, cfg, 23)
+		child := log.WithKafkaFilterFn(setField("first", true))
+		grandchild := child.WithFields(LogFields{"fixed": 1}).
+			WithKafkaFilterFn(func(msg *map[string]interface{}) {
+				// filters run in the order they were added
+				(*msg)["second"] = (*msg)["first"]
+			}).WithKafkaKeyFn(func(msg *map[string]interface{}) string {
+			return "grandchild"
+		})
+
+		log.Info("root")
+		child.Info("child")
+		grandchild.Info("grandchild")
+
+		// loggers can be derived and used concurrently
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				child.WithKafkaFilterFn(setField("index", i)).Info("concurrent")
+				grandchild.Info("concurrent")
+			}(i)
+		}
+		wg.Wait()
+		closeLogger(t, cfg, log)
+
+		values := recorder.values(t)
+		if len(values) != 23 {
+			t.Fatalf("%s sent %d messages, expected 23", pkg, len(values))
+		}
+		if _, ok := values[0]["first"]; ok {
+			t.Errorf("%s root message filtered: %v\n", pkg, values[0])
+		}
+		if values[1]["first"] != true || values[1]["second"] != nil {
+			t.Errorf("%s child message fields: %v\n", pkg, values[1])
+		}
+		if values[2]["first"] != true || values[2]["second"] != true ||
+			values[2]["fixed"] != 1.0 {
+			t.Errorf("%s grandchild message fields: %v\n", pkg, values[2])
+		}
+		for i, expected := range []string{"info", "info", "grandchild"} {
+			key, _ := recorder.messages[i].Key.Encode()
+			if string(key) != expected {
+				t.Errorf("%s message %d key %s, expected %s\n", pkg, i, key,
+					expected)
+			}
+		}
+		var indexed int
+		for _, value := range values[3:] {
+			if _, ok := value["index"]; ok {
+				indexed++
+			}
+		}
+		if indexed != 10 {
+			t.Errorf("%s %d concurrent messages indexed, expected 10\n", pkg,
+				indexed)
+		}
+
+		// loggers without kafka accept the functions
+		noKafka, err := NewLogger(LoggerConfiguration{LogPackage: pkg})
+		if err != nil {
+			t.Fatalf("Failed to instantiate %s logger: %s", pkg, err.Error())
+		}
+		noKafka.WithFields(LogFields{"key": "value"}).
+			WithKafkaFilterFn(setField("first", true)).
+			WithKafkaKeyFn(func(msg *map[string]interface{}) string {
+				return ""
+			}).Debug("not logged")
+	}
+}
+
+func TestKafkaRoutes(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	// routes are declared in the config file
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	content := `kafkaproducercfg:
+  topic: logs
+  key: level
+  routes:
+  - fields: {audit: ""}
+    topic: audit
+    key: extracted
+    keyname: user
+  - levels: [debug]
+    drop: true
+  - message: ^login
+    topic: security
+`
+	cfgFile := filepath.Join(dir, "pr_routes_config.yaml")
+	if err := ioutil.WriteFile(cfgFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %s", cfgFile, err.Error())
+	}
+	fileCfg, err := GetLoggerConfiguration(FileConfig, "pr_routes_config")
+	if err != nil {
+		t.Fatalf("Failed to read configuration: %s", err.Error())
+	}
+	routes := fileCfg.KafkaProducerCfg.Routes
+	if len(routes) != 3 {
+		t.Fatalf("Read %d routes, expected 3: %+v", len(routes), routes)
+	}
+
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		cfg := LoggerConfiguration{
+			LogPackage:       pkg,
+			LogLevel:         DebugType,
+			KafkaFormat:      JSONFormat,
+			KafkaProducerCfg: fileCfg.KafkaProducerCfg,
+		}
+		log, recorder := mockKafkaLogger(t, cfg, 4)
+		log.Infow("record", "audit", true, "user", "alice")
+		log.Debug("dropped by route")
+		log.Info("login failed")
+		log.WithFields(LogFields{TopicKey: "custom"}).Info("login override")
+		log.Error("default route")
+		closeLogger(t, cfg, log)
+
+		values := recorder.values(t)
+		if len(values) != 4 {
+			t.Fatalf("%s sent %d messages, expected 4", pkg, len(values))
+		}
+		for i, expected := range []struct{ topic, key string }{
+			{"audit", "alice"},
+			{"security", "info"},
+			{"custom", "info"},
+			{"logs", "error"},
+		} {
+			msg := recorder.messages[i]
+			key, _ := msg.Key.Encode()
+			if msg.Topic != expected.topic || string(key) != expected.key {
+				t.Errorf("%s message %d topic %s key %s, expected %s %s\n",
+					pkg, i, msg.Topic, key, expected.topic, expected.key)
+			}
+		}
+		if _, ok := values[0]["user"]; ok {
+			t.Errorf("%s extracted key left in message: %v\n", pkg, values[0])
+		}
+	}
+
+	var errCount int
+	checkProducerConfig(ProducerConfiguration{Routes: []RouteConfiguration{
+		{Levels: []LevelType{"verbose"}},
+		{Message: "(", Key: "user"},
+		{Drop: true, Topic: "audit"},
+	}}, &errCount)
+	if errCount != 4 {
+		t.Errorf("Found %d configuration errors, expected 4\n", errCount)
+	}
+}
+
+func TestKafkaHeaders(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		for _, remove := range []bool{false, true} {
+			cfg := LoggerConfiguration{
+				LogPackage:  pkg,
+				LogLevel:    InfoType,
+				KafkaFormat: JSONFormat,
+				KafkaProducerCfg: ProducerConfiguration{
+					HeaderFields:  []string{"tenant", "request_id", "level"},
+					RemoveHeaders: remove,
+				},
+			}
+			log, recorder := mockKafkaLogger(t, cfg, 2)
+			log.Infow("promoted", "tenant", "acme", "request_id", 42)
+			log.Warn("level only")
+			closeLogger(t, cfg, log)
+
+			values := recorder.values(t)
+			if len(values) != 2 {
+				t.Fatalf("%s sent %d messages, expected 2", pkg, len(values))
+			}
+			for i, expected := range []map[string]string{
+				{"tenant": "acme", "request_id": "42", "level": "info"},
+				{"level": "warn"},
+			} {
+				headers := make(map[string]string)
+				for _, header := range recorder.messages[i].Headers {
+					headers[string(header.Key)] = string(header.Value)
+				}
+				// logrus names the warn level warning
+				if pkg == LogrusType && headers["level"] == "warning" {
+					headers["level"] = "warn"
+				}
+				if !reflect.DeepEqual(headers, expected) {
+					t.Errorf("%s message %d headers %v, expected %v\n", pkg,
+						i, headers, expected)
+				}
+				for name := range expected {
+					if _, ok := values[i][name]; ok == remove {
+						t.Errorf("%s message %d remove %t body %v\n", pkg, i,
+							remove, values[i])
+					}
+				}
+			}
+		}
+	}
+
+	var errCount int
+	checkProducerConfig(ProducerConfiguration{
+		HeaderFields: []string{"tenant", "", "tenant"},
+	}, &errCount)
+	if errCount != 2 {
+		t.Errorf("Found %d configuration errors, expected 2\n", errCount)
+	}
+}
+
+// requestIDKey is the context key of the request ID extractor test
+type requestIDKey struct{}
+
+func TestContextFields(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	RegisterContextExtractor(func(ctx context.Context) LogFields {
+		if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+			return LogFields{"requestid": id}
+		}
+		return nil
+	})
+
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		cfg := LoggerConfiguration{
+			LogPackage:  pkg,
+			LogLevel:    InfoType,
+			KafkaFormat: JSONFormat,
+		}
+		log, recorder := mockKafkaLogger(t, cfg, 3)
+
+		ctx := context.WithValue(context.Background(), requestIDKey{}, "r1")
+		log.WithContext(ctx).Info("with context")
+		log.WithContext(context.Background()).Info("without fields")
+
+		ctx = NewContext(ctx, log.WithFields(LogFields{"tenant": "t1"}))
+		FromContext(ctx).Infow("from context", "user", "alice")
+		closeLogger(t, cfg, log)
+
+		values := recorder.values(t)
+		if len(values) != 3 {
+			t.Fatalf("%s sent %d messages, expected 3", pkg, len(values))
+		}
+		if values[0]["requestid"] != "r1" {
+			t.Errorf("%s context message missing requestid: %v\n", pkg,
+				values[0])
+		}
+		if _, ok := values[1]["requestid"]; ok {
+			t.Errorf("%s message without context has requestid: %v\n", pkg,
+				values[1])
+		}
+		if values[2]["requestid"] != "r1" || values[2]["tenant"] != "t1" ||
+			values[2]["user"] != "alice" {
+			t.Errorf("%s FromContext message fields: %v\n", pkg, values[2])
+		}
+	}
+}
+
+func TestTraceFields(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(recorder))
+	state, err := trace.ParseTraceState("vendor=value")
+	if err != nil {
+		t.Fatalf("Failed to parse trace state: %s", err.Error())
+	}
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+		TraceState: state,
+		Remote:     true,
+	})
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), remote)
+	ctx, span := provider.Tracer("logger").Start(ctx, "request")
+	span.End()
+	sc := recorder.Ended()[0].SpanContext()
+	parent := fmt.Sprintf("00-%s-%s-01", sc.TraceID(), sc.SpanID())
+
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		cfg := LoggerConfiguration{
+			LogPackage:        pkg,
+			LogLevel:          InfoType,
+			EnableCloudEvents: true,
+			KafkaFormat:       CEFormat,
+		}
+		log, kafka := mockKafkaLogger(t, cfg, 2)
+		log.WithContext(ctx).Info("traced")
+		log.WithContext(context.Background()).Info("untraced")
+		closeLogger(t, cfg, log)
+
+		values := kafka.values(t)
+		if len(values) != 2 {
+			t.Fatalf("%s sent %d messages, expected 2", pkg, len(values))
+		}
+		expected := map[string]interface{}{
+			TraceIDKey:       sc.TraceID().String(),
+			SpanIDKey:        sc.SpanID().String(),
+			TraceFlagsKey:    "01",
+			CETraceParentKey: parent,
+			CETraceStateKey:  "vendor=value",
+		}
+		for key, value := range expected {
+			if values[0][key] != value {
+				t.Errorf("%s field %s is %v, expected %v\n", pkg, key,
+					values[0][key], value)
+			}
+			if _, ok := values[1][key]; ok {
+				t.Errorf("%s untraced message has field %s\n", pkg, key)
+			}
+		}
+
+		headers := map[string]string{}
+		for _, header := range kafka.messages[0].Headers {
+			headers[string(header.Key)] = string(header.Value)
+		}
+		if headers[CETraceParentKey] != parent ||
+			headers[CETraceStateKey] != "vendor=value" {
+			t.Errorf("%s trace headers %v\n", pkg, headers)
+		}
+		if len(kafka.messages[1].Headers) != 0 {
+			t.Errorf("%s untraced message has headers %v\n", pkg,
+				kafka.messages[1].Headers)
+		}
+	}
+}
+
+func TestSinkLevels(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	// sink levels are read from the environment like other settings
+	t.Setenv(LogEnvPrefix+"_KAFKALEVEL", string(WarnType))
+	cfg, err := GetLoggerConfiguration(EnvConfig, "")
+	if err != nil {
+		t.Fatalf("Failed to read configuration: %s", err.Error())
+	}
+	if cfg.KafkaLevel != WarnType || cfg.FileLevel != "" {
+		t.Errorf("KafkaLevel %s FileLevel %s, expected %s and none\n",
+			cfg.KafkaLevel, cfg.FileLevel, WarnType)
+	}
+
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		location := filepath.Join(t.TempDir(), "levels.log")
+		cfg := LoggerConfiguration{
+			LogPackage:   pkg,
+			LogLevel:     InfoType,
+			KafkaFormat:  JSONFormat,
+			KafkaLevel:   WarnType,
+			EnableFile:   true,
+			FileFormat:   JSONFormat,
+			FileLocation: location,
+			FileLevel:    DebugType,
+		}
+		log, kafka := mockKafkaLogger(t, cfg, 2)
+		log.Debug("debug")
+		log.Info("info")
+		log.Warn("warn")
+
+		// only sinks following the log level are changed
+		log.SetLevel(ErrorType)
+		if level := log.GetLevel(); level != ErrorType {
+			t.Errorf("%s level %s, expected %s\n", pkg, level, ErrorType)
+		}
+		log.Debug("debug after SetLevel")
+		log.Warn("warn after SetLevel")
+		closeLogger(t, cfg, log)
+
+		var sent []string
+		for _, value := range kafka.values(t) {
+			sent = append(sent, value["msg"].(string))
+		}
+		expected := []string{"warn", "warn after SetLevel"}
+		if strings.Join(sent, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s kafka got %v, expected %v\n", pkg, sent, expected)
+		}
+
+		content, err := ioutil.ReadFile(location)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %s", location, err.Error())
+		}
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		if len(lines) != 5 {
+			t.Errorf("%s file has %d lines, expected 5: %s", pkg,
+				len(lines), content)
+		}
+	}
+}
+
+func TestCloudEventsFile(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		location := filepath.Join(t.TempDir(), "cloudevents.log")
+		cfg := LoggerConfiguration{
+			LogPackage:        pkg,
+			LogLevel:          InfoType,
+			EnableCloudEvents: true,
+			CloudEventsCfg:    CloudEventsConfiguration{SetID: CEIncrID},
+			KafkaFormat:       CEFormat,
+			EnableFile:        true,
+			FileFormat:        CEFormat,
+			FileLocation:      location,
+		}
+		log, kafka := mockKafkaLogger(t, cfg, 2)
+		log.Info("first")
+		log.Info("second")
+		closeLogger(t, cfg, log)
+
+		values := kafka.values(t)
+		if len(values) != 2 {
+			t.Fatalf("%s sent %d messages, expected 2", pkg, len(values))
+		}
+		content, err := ioutil.ReadFile(location)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %s", location, err.Error())
+		}
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("%s file has %d lines, expected 2", pkg, len(lines))
+		}
+		for i, line := range lines {
+			var record map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("%s file line %s: %s", pkg, line, err.Error())
+			}
+			expected := fmt.Sprintf("%020d", i+1)
+			if record[CEIDKey] != expected || values[i][CEIDKey] != expected {
+				t.Errorf("%s record %d file id %v kafka id %v, expected %s\n",
+					pkg, i, record[CEIDKey], values[i][CEIDKey], expected)
+			}
+			if record[CEDataKey] != values[i][CEDataKey] {
+				t.Errorf("%s record %d file data %v kafka data %v\n", pkg, i,
+					record[CEDataKey], values[i][CEDataKey])
+			}
+		}
+	}
+}
+
+// TestKafkaFields checks kafka records sent as fields match the records
+// the encoders of the same format write to the file sink
+func TestKafkaFields(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	stamp := time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		for _, format := range []FormatType{JSONFormat, CEFormat} {
+			location := filepath.Join(t.TempDir(), "fields.log")
+			cfg := LoggerConfiguration{
+				LogPackage:        pkg,
+				LogLevel:          InfoType,
+				EnableTimeStamps:  true,
+				EnableCloudEvents: format == CEFormat,
+				CloudEventsCfg: CloudEventsConfiguration{
+					SetID:           CEIncrID,
+					SetSubjectLevel: true,
+				},
+				KafkaFormat:  format,
+				EnableFile:   true,
+				FileFormat:   format,
+				FileLocation: location,
+			}
+			log, kafka := mockKafkaLogger(t, cfg, 2)
+			log.WithFields(LogFields{"fixed": "value", "count": 1}).Infow(
+				"typed", "int", 42, "float", 1.5, "bool", true,
+				"error", errors.New("failed"), "time", stamp,
+				"duration", time.Second,
+				"nested", map[string]interface{}{"list": []int{1, 2}})
+			log.Warnw("clash", "msg", "field")
+			closeLogger(t, cfg, log)
+
+			values := kafka.values(t)
+			if len(values) != 2 {
+				t.Fatalf("%s %s sent %d messages, expected 2", pkg, format,
+					len(values))
+			}
+			content, err := ioutil.ReadFile(location)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %s", location, err.Error())
+			}
+			lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+			for i, line := range lines {
+				var record map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("%s file line %s: %s", pkg, line, err.Error())
+				}
+				if !reflect.DeepEqual(record, values[i]) {
+					t.Errorf("%s %s record %d kafka %v, expected %v\n", pkg,
+						format, i, values[i], record)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkKafka measures logging to kafka with each package and format
+// the decode runs use the same loggers with records encoded by the sink and
+// decoded again by the producer, as sinks without a kafka layout do
+func BenchmarkKafka(b *testing.B) {
+	newAckProducer(b, 0)
+	dir := b.TempDir()
+	for _, format := range []FormatType{JSONFormat, CEFormat} {
+		cfg := LoggerConfiguration{
+			LogLevel:          InfoType,
+			EnableTimeStamps:  true,
+			EnableKafka:       true,
+			KafkaFormat:       format,
+			EnableCloudEvents: format == CEFormat,
+			CloudEventsCfg:    CloudEventsConfiguration{SetID: CEIncrID},
+			KafkaProducerCfg: ProducerConfiguration{
+				Key:          ExtractedKey,
+				KeyName:      "user",
+				HeaderFields: []string{"tenant"},
+				Routes: []RouteConfiguration{
+					{Levels: []LevelType{ErrorType}, Topic: "errors"},
+				},
+				EnableSpool: true,
+				SpoolCfg: SpoolConfiguration{
+					Directory: filepath.Join(dir, "spool"),
+				},
+			},
+		}
+
+		for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+			cfg.LogPackage = pkg
+			for _, decode := range []bool{true, false} {
+				name := fmt.Sprintf("%s/%s/fields", pkg, format)
+				newLayout := getKafkaLayout
+				if decode {
+					name = fmt.Sprintf("%s/%s/decode", pkg, format)
+					newLayout = func(LoggerConfiguration,
+						*CloudEvents) *kafkaLayout {
+						return nil
+					}
+				}
+				b.Run(name, func(b *testing.B) {
+					newKafkaLayout = newLayout
+					defer func() { newKafkaLayout = getKafkaLayout }()
+					log, err := NewLogger(cfg)
+					if err != nil {
+						b.Fatalf("Failed to instantiate %s logger: %s", pkg,
+							err.Error())
+					}
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						log.Infow("benchmark", "user", "alice",
+							"tenant", "t1", "count", i)
+					}
+					b.StopTimer()
+					log.Close(context.Background())
+				})
+			}
+		}
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		location := filepath.Join(t.TempDir(), "handler.log")
+		cfg := LoggerConfiguration{
+			LogPackage:   pkg,
+			LogLevel:     InfoType,
+			KafkaFormat:  JSONFormat,
+			EnableFile:   true,
+			FileFormat:   JSONFormat,
+			FileLocation: location,
+		}
+		log, kafka := mockKafkaLogger(t, cfg, 2)
+		ctx := context.WithValue(context.Background(), requestIDKey{}, "r1")
+		slogger := slog.New(NewSlogHandler(log)).With("service", "api")
+		slogger.WithGroup("req").InfoContext(ctx, "handled", "status", 200,
+			slog.Group("user", "id", "alice"))
+		slogger.Debug("filtered by level")
+		slogger.Log(ctx, slog.LevelError+2, "above error")
+		closeLogger(t, cfg, log)
+
+		values := kafka.values(t)
+		if len(values) != 2 {
+			t.Fatalf("%s sent %d messages, expected 2", pkg, len(values))
+		}
+		if values[0]["msg"] != "handled" || values[0]["level"] != "info" ||
+			values[0]["service"] != "api" || values[0]["req.status"] != 200.0 ||
+			values[0]["req.user.id"] != "alice" {
+			t.Errorf("%s handled message fields: %v\n", pkg, values[0])
+		}
+		if values[1]["level"] != "error" {
+			t.Errorf("%s above error message level %v, expected error\n", pkg,
+				values[1]["level"])
+		}
+
+		content, err := ioutil.ReadFile(location)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %s", location, err.Error())
+		}
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		if len(lines) != 2 {
+			t.Errorf("%s file has %d lines, expected 2: %s", pkg,
+				len(lines), content)
+		}
+	}
+}
+
+// readSyslogFrames reads octet counted messages from a stream connection
+func readSyslogFrames(t *testing.T, conn net.Conn, count int) []string {
+	var msgs []string
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	for len(msgs) < count {
+		var length int
+		if _, err := fmt.Fscanf(reader, "%d ", &length); err != nil {
+			t.Fatalf("Failed to read syslog frame length: %s", err.Error())
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			t.Fatalf("Failed to read syslog frame: %s", err.Error())
+		}
+		msgs = append(msgs, string(msg))
+	}
+	return msgs
+}
+
+// TestSinkOpenFailure checks the sinks opened before a sink fails to open
+// are released
+func TestSinkOpenFailure(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	// nothing listens on the address once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on tcp: %s", err.Error())
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	newAckProducer(t, 0)
+	dir := t.TempDir()
+	for _, pkg := range []PackageType{ZapType, LogrusType, SlogType} {
+		cfg := LoggerConfiguration{
+			LogPackage:   pkg,
+			LogLevel:     InfoType,
+			EnableKafka:  true,
+			EnableFile:   true,
+			FileLocation: filepath.Join(dir, "failure.log"),
+			EnableSyslog: true,
+			SyslogCfg: SyslogConfiguration{
+				Network: SyslogTCP,
+				Address: address,
+			},
+			KafkaProducerCfg: ProducerConfiguration{
+				EnableSpool: true,
+				SpoolCfg: SpoolConfiguration{
+					Directory: filepath.Join(dir, "spool"),
+				},
+			},
+		}
+		if pkg == SlogType {
+			// slog has no syslog sink, the file is opened after kafka
+			cfg.EnableSyslog = false
+			cfg.FileLocation = filepath.Join(dir, "missing", "failure.log")
+		}
+		if _, err := newPackageLogger(cfg); err == nil {
+			t.Fatalf("%s logger created with a failing sink", pkg)
+		}
+		if sinkOpen(cfg.FileLocation) ||
+			sinkOpen(cfg.KafkaProducerCfg.SpoolCfg.Directory) {
+			t.Errorf("%s sinks not released\n", pkg)
+		}
+	}
+}
+
+func TestSyslog(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on udp: %s", err.Error())
+	}
+	defer udp.Close()
+
+	// unix socket paths are limited to about 100 bytes
+	dir, err := ioutil.TempDir("", "syslog")
+	if err != nil {
+		t.Fatalf("Failed to create socket directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	unix, err := net.Listen("unix", filepath.Join(dir, "syslog.sock"))
+	if err != nil {
+		t.Fatalf("Failed to listen on unix socket: %s", err.Error())
+	}
+	defer unix.Close()
+
+	expected := []*regexp.Regexp{
+		regexp.MustCompile(`^<132>1 \S+ testhost testapp \d+ - ` +
+			`\[fields@32473 count="2" user="a\\"b\\]"\] warning$`),
+		regexp.MustCompile(`^<134>1 \S+ testhost testapp \d+ - - info$`),
+	}
+
+	for _, pkg := range []PackageType{ZapType, LogrusType} {
+		for _, network := range []syslogNetworkType{SyslogUDP, SyslogUnix} {
+			address := udp.LocalAddr().String()
+			if network == SyslogUnix {
+				address = unix.Addr().String()
+			}
+			cfg := LoggerConfiguration{
+				LogPackage:   pkg,
+				LogLevel:     InfoType,
+				EnableSyslog: true,
+				SyslogCfg: SyslogConfiguration{
+					Network:  network,
+					Address:  address,
+					Facility: "local0",
+					AppName:  "testapp",
+					Hostname: "testhost",
+				},
+			}
+			log, err := NewLogger(cfg)
+			if err != nil {
+				t.Fatalf("Failed to create %s logger: %s", pkg, err.Error())
+			}
+
+			log.WithFields(LogFields{"user": `a"b]`, "count": 2}).Warn("warning")
+			log.Debug("debug")
+			log.Info("info")
+
+			var msgs []string
+			if network == SyslogUnix {
+				// the connection is queued until accepted
+				conn, err := unix.Accept()
+				if err != nil {
+					t.Fatalf("Failed to accept: %s", err.Error())
+				}
+				msgs = readSyslogFrames(t, conn, 2)
+				conn.Close()
+			} else {
+				buf := make([]byte, 2048)
+				udp.SetReadDeadline(time.Now().Add(5 * time.Second))
+				for len(msgs) < 2 {
+					n, _, err := udp.ReadFrom(buf)
+					if err != nil {
+						t.Fatalf("Failed to read datagram: %s", err.Error())
+					}
+					msgs = append(msgs, string(buf[:n]))
+				}
+			}
+			closeLogger(t, cfg, log)
+
+			for i, msg := range msgs {
+				if !expected[i].MatchString(msg) {
+					t.Errorf("%s %s message %q does not match %s\n", pkg,
+						network, msg, expected[i])
+				}
+			}
+		}
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	type request struct {
+		contentType   string
+		authorization string
+		tenant        string
+		body          []byte
+	}
+	var mut sync.Mutex
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mut.Lock()
+			defer mut.Unlock()
+			requests = append(requests, request{r.Header.Get("Content-Type"),
+				r.Header.Get("Authorization"), r.Header.Get("X-Tenant"), body})
+			if len(requests) == 1 {
+				// the first request is retried
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+	defer server.Close()
+
+	for _, pkg := range []PackageType{ZapType, LogrusType} {
+		for _, mode := range []httpModeType{HTTPBatch, HTTPStructured} {
+			requests = nil
+			cfg := LoggerConfiguration{
+				LogPackage:        pkg,
+				LogLevel:          InfoType,
+				EnableCloudEvents: true,
+				CloudEventsCfg:    CloudEventsConfiguration{SetID: CEIncrID},
+				EnableHTTP:        true,
+				HTTPFormat:        CEFormat,
+				HTTPCfg: HTTPConfiguration{
+					URL:         server.URL,
+					Mode:        mode,
+					Headers:     map[string]string{"X-Tenant": "test"},
+					BearerToken: "secret",
+					BatchSize:   2,
+					FlushFreq:   time.Hour,
+					RetryMax:    1,
+					RetryFreq:   10 * time.Millisecond,
+				},
+			}
+			log, err := NewLogger(cfg)
+			if err != nil {
+				t.Fatalf("Failed to create %s logger: %s", pkg, err.Error())
+			}
+			log.Info("first")
+			log.Debug("filtered")
+			log.Info("second")
+			log.Info("third")
+			closeLogger(t, cfg, log)
+
+			// the failed request is sent again, the last batch on close
+			contentType := httpCEBatchContentType
+			expected := 3
+			if mode == HTTPStructured {
+				contentType = httpCEContentType
+				expected = 4
+			}
+			if len(requests) != expected {
+				t.Fatalf("%s %s got %d requests, expected %d", pkg, mode,
+					len(requests), expected)
+			}
+
+			var records []map[string]interface{}
+			for _, req := range requests[1:] {
+				if req.contentType != contentType ||
+					req.authorization != "Bearer secret" ||
+					req.tenant != "test" {
+					t.Errorf("%s %s request headers %+v\n", pkg, mode, req)
+				}
+				if mode == HTTPStructured {
+					var record map[string]interface{}
+					if err := json.Unmarshal(req.body, &record); err != nil {
+						t.Fatalf("%s %s body %s: %s", pkg, mode, req.body,
+							err.Error())
+					}
+					records = append(records, record)
+					continue
+				}
+				var batch []map[string]interface{}
+				if err := json.Unmarshal(req.body, &batch); err != nil {
+					t.Fatalf("%s %s body %s: %s", pkg, mode, req.body,
+						err.Error())
+				}
+				records = append(records, batch...)
+			}
+
+			for i, data := range []string{"first", "second", "third"} {
+				id := fmt.Sprintf("%020d", i+1)
+				if records[i][CEDataKey] != data || records[i][CEIDKey] != id {
+					t.Errorf("%s %s record %d is %v, expected data %s id %s\n",
+						pkg, mode, i, records[i], data, id)
+				}
+			}
+		}
+	}
+}
+
+// TestHTTPSinkCloseTimeout checks close returns when ctx is done while the
+// sender retries and a writer waits for the full queue
+func TestHTTPSinkCloseTimeout(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	hw := newBatchWriter(HTTPConfiguration{
+		BatchSize:    2,
+		QueueSize:    1,
+		FlushFreq:    time.Hour,
+		RetryMax:     5,
+		RetryFreq:    time.Hour,
+		ErrorHandler: func(url string, body []byte, err error) {},
+	}, httpJSONContentType, httpEncoder(HTTPBatch))
+	sending := make(chan struct{}, 1)
+	hw.send = func(body []byte) ([]byte, bool, time.Duration, error) {
+		select {
+		case sending <- struct{}{}:
+		default:
+		}
+		return nil, true, 0, errors.New("unavailable")
+	}
+
+	// the first batch is retried, the second fills the queue and the
+	// writer of the third waits for the queue
+	for i := 0; i < 2; i++ {
+		hw.Write([]byte(`{"msg":"first"}`))
+	}
+	<-sending
+	for i := 0; i < 3; i++ {
+		hw.Write([]byte(`{"msg":"second"}`))
+	}
+	written := make(chan struct{})
+	go func() {
+		hw.Write([]byte(`{"msg":"third"}`))
+		close(written)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+	closed := make(chan error)
+	go func() { closed <- hw.closeContext(ctx) }()
+	select {
+	case err := <-closed:
+		if err == nil {
+			t.Errorf("Close with records in backoff did not fail\n")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close did not return when ctx was done")
+	}
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Write waiting for the full queue was not released")
+	}
+}
+
+// TestHTTPSinkSync checks Sync waits for the records written before it
+// while other writers keep writing
+func TestHTTPSinkSync(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	hw := newBatchWriter(HTTPConfiguration{
+		BatchSize: 1,
+		QueueSize: 4,
+		FlushFreq: time.Hour,
+	}, httpJSONContentType, httpEncoder(HTTPBatch))
+	var synced int64
+	hw.send = func(body []byte) ([]byte, bool, time.Duration, error) {
+		var records []map[string]interface{}
+		if err := json.Unmarshal(body, &records); err == nil {
+			if n, ok := records[0]["sync"].(float64); ok {
+				atomic.StoreInt64(&synced, int64(n))
+			}
+		}
+		return nil, false, 0, nil
+	}
+
+	stop := make(chan struct{})
+	var writers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					hw.Write([]byte(`{"msg":"busy"}`))
+				}
+			}
+		}()
+	}
+	for i := 1; i <= 20; i++ {
+		hw.Write([]byte(fmt.Sprintf(`{"sync":%d}`, i)))
+		hw.Sync()
+		if n := atomic.LoadInt64(&synced); n != int64(i) {
+			t.Fatalf("Sync returned before record %d was sent, last %d", i, n)
+		}
+	}
+	close(stop)
+	writers.Wait()
+	if err := hw.closeContext(context.Background()); err != nil {
+		t.Errorf("Close failed: %s", err.Error())
+	}
+}
+
+// decodeLokiPush returns the lines of each stream of a loki push request
+func decodeLokiPush(t *testing.T, encoding lokiEncodingType,
+	body []byte) map[string][]string {
+
+	streams := make(map[string][]string)
+	if encoding == LokiJSON {
+		var request struct {
+			Streams []struct {
+				Stream map[string]string `json:"stream"`
+				Values [][2]string       `json:"values"`
+			} `json:"streams"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Fatalf("Failed to decode push request: %s", err.Error())
+		}
+		for _, stream := range request.Streams {
+			key := lokiLabelString(stream.Stream)
+			for _, value := range stream.Values {
+				streams[key] = append(streams[key], value[1])
+			}
+		}
+		return streams
+	}
+
+	// consume returns the bytes fields of a protobuf message by number
+	consume := func(msg []byte) map[protowire.Number][][]byte {
+		fields := make(map[protowire.Number][][]byte)
+		for len(msg) > 0 {
+			num, typ, n := protowire.ConsumeTag(msg)
+			msg = msg[n:]
+			if typ != protowire.BytesType {
+				n = protowire.ConsumeFieldValue(num, typ, msg)
+				msg = msg[n:]
+				continue
+			}
+			value, n := protowire.ConsumeBytes(msg)
+			if n < 0 {
+				t.Fatalf("Failed to decode push request field %d", num)
+			}
+			fields[num] = append(fields[num], value)
+			msg = msg[n:]
+		}
+		return fields
+	}
+	request, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("Failed to decompress push request: %s", err.Error())
+	}
+	for _, stream := range consume(request)[1] {
+		fields := consume(stream)
+		key := string(fields[1][0])
+		for _, entry := range fields[2] {
+			streams[key] = append(streams[key], string(consume(entry)[2][0]))
+		}
+	}
+	return streams
+}
+
+func TestLokiSink(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	type request struct {
+		contentType string
+		tenant      string
+		body        []byte
+	}
+	var mut sync.Mutex
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mut.Lock()
+			defer mut.Unlock()
+			requests = append(requests, request{r.Header.Get("Content-Type"),
+				r.Header.Get(lokiTenantHeader), body})
+			if len(requests) == 1 {
+				// the rate limited request is retried
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	defer server.Close()
+
+	info := `{env="test", level="info", service="svc", user="alice"}`
+	warn := `{env="test", level="warn", service="svc"}`
+	for _, pkg := range []PackageType{ZapType, LogrusType} {
+		for _, encoding := range []lokiEncodingType{LokiProtobuf, LokiJSON} {
+			requests = nil
+			cfg := LoggerConfiguration{
+				LogPackage: pkg,
+				LogLevel:   InfoType,
+				EnableLoki: true,
+				LokiFormat: JSONFormat,
+				LokiCfg: LokiConfiguration{
+					URL:       server.URL + "/loki/api/v1/push",
+					Encoding:  encoding,
+					TenantID:  "tenant",
+					Service:   "svc",
+					Labels:    map[string]string{"env": "test"},
+					LabelKeys: []string{"user"},
+					BatchSize: 10,
+					FlushFreq: time.Hour,
+					RetryMax:  1,
+					RetryFreq: 10 * time.Millisecond,
+				},
+			}
+			log, err := NewLogger(cfg)
+			if err != nil {
+				t.Fatalf("Failed to create %s logger: %s", pkg, err.Error())
+			}
+			user := log.WithFields(LogFields{"user": "alice"})
+			user.Info("one")
+			log.Warn("two")
+			user.Info("three")
+			closeLogger(t, cfg, log)
+
+			if len(requests) != 2 {
+				t.Fatalf("%s %s got %d requests, expected 2", pkg, encoding,
+					len(requests))
+			}
+			req := requests[1]
+			contentType := lokiProtobufContentType
+			if encoding == LokiJSON {
+				contentType = lokiJSONContentType
+			}
+			if req.contentType != contentType || req.tenant != "tenant" {
+				t.Errorf("%s %s request headers %+v\n", pkg, encoding, req)
+			}
+
+			streams := decodeLokiPush(t, encoding, req.body)
+			if len(streams) != 2 || len(streams[info]) != 2 ||
+				len(streams[warn]) != 1 {
+				t.Fatalf("%s %s got streams %v", pkg, encoding, streams)
+			}
+			for i, msg := range []string{"one", "three"} {
+				if !strings.Contains(streams[info][i], `"msg":"`+msg+`"`) {
+					t.Errorf("%s %s line %s, expected msg %s\n", pkg, encoding,
+						streams[info][i], msg)
+				}
+			}
+		}
+	}
+
+	// fatal records are sent before zap exits
+	requests = nil
+	cfg := LoggerConfiguration{
+		LogPackage: ZapType,
+		LogLevel:   InfoType,
+		EnableLoki: true,
+		LokiFormat: JSONFormat,
+		LokiCfg: LokiConfiguration{
+			URL:       server.URL + "/loki/api/v1/push",
+			Encoding:  LokiJSON,
+			BatchSize: 10,
+			FlushFreq: time.Hour,
+			RetryMax:  1,
+			RetryFreq: 10 * time.Millisecond,
+		},
+	}
+	log, err := NewLogger(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create zap logger: %s", err.Error())
+	}
+	writeZapFatal(t, log)
+	mut.Lock()
+	sent := len(requests) > 0 &&
+		bytes.Contains(requests[len(requests)-1].body, []byte("fatal"))
+	mut.Unlock()
+	if !sent {
+		t.Errorf("Fatal record not sent before exit\n")
+	}
+	closeLogger(t, cfg, log)
+
+	// streams without entries for lokiStreamAge are forgotten
+	lw := newLokiWriter(cfg.LokiCfg)
+	now := time.Now()
+	lw.lastTime["idle"] = now.Add(-2 * lokiStreamAge)
+	lw.lastTime["recent"] = now.Add(-time.Minute)
+	lw.prune(now)
+	if _, ok := lw.lastTime["idle"]; ok || len(lw.lastTime) != 1 {
+		t.Errorf("Streams after prune: %v\n", lw.lastTime)
+	}
+	lw.closeContext(context.Background())
+}
+
+func TestElasticSink(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	var mut sync.Mutex
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mut.Lock()
+			defer mut.Unlock()
+			if r.URL.Path != "/_bulk" ||
+				r.Header.Get("Content-Type") != elasticContentType ||
+				r.Header.Get("Authorization") != "ApiKey key" {
+				t.Errorf("Unexpected bulk request %s %v\n", r.URL, r.Header)
+			}
+			bodies = append(bodies, body)
+			// the second record is rejected
+			fmt.Fprint(w, `{"errors":true,"items":[`+
+				`{"create":{"status":201}},`+
+				`{"create":{"status":400,"error":{"type":"mapper_parsing_exception",`+
+				`"reason":"failed to parse"}}}]}`)
+		}))
+	defer server.Close()
+
+	for _, pkg := range []PackageType{ZapType, LogrusType} {
+		bodies = nil
+		var rejected error
+		cfg := LoggerConfiguration{
+			LogPackage:    pkg,
+			LogLevel:      InfoType,
+			ServiceName:   "Billing",
+			EnableElastic: true,
+			ElasticFormat: ECSFormat,
+			ElasticCfg: ElasticConfiguration{
+				URL:       server.URL,
+				Index:     "logs-%{service}-%{tenant}-%{+2006}",
+				APIKey:    "key",
+				BatchSize: 2,
+				FlushFreq: time.Hour,
+				ErrorHandler: func(url string, msg []byte, err error) {
+					rejected = err
+				},
+			},
+		}
+		log, err := NewLogger(cfg)
+		if err != nil {
+			t.Fatalf("Failed to create %s logger: %s", pkg, err.Error())
+		}
+		log.WithFields(LogFields{"tenant": "acme"}).Info("paid")
+		log.Errorw("declined", "error", errors.New("card expired"))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = log.Close(ctx)
+		cancel()
+
+		if err == nil || rejected == nil ||
+			!strings.Contains(rejected.Error(), "rejected 1 of 2") {
+			t.Errorf("%s close error %v rejected %v, expected 1 rejected\n",
+				pkg, err, rejected)
+		}
+		if len(bodies) != 1 {
+			t.Fatalf("%s got %d bulk requests, expected 1", pkg, len(bodies))
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(bodies[0])), "\n")
+		if len(lines) != 4 {
+			t.Fatalf("%s bulk body has %d lines, expected 4", pkg, len(lines))
+		}
+		year := time.Now().UTC().Format("2006")
+		for i, index := range []string{"logs-billing-acme-" + year,
+			"logs-billing--" + year} {
+			expected := `{"create":{"_index":"` + index + `"}}`
+			if lines[2*i] != expected {
+				t.Errorf("%s action %s, expected %s\n", pkg, lines[2*i],
+					expected)
+			}
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[3]), &doc); err != nil {
+			t.Fatalf("%s document %s: %s", pkg, lines[3], err.Error())
+		}
+		expected := map[string]string{
+			ECSMessageKey:      "declined",
+			ECSLevelKey:        "error",
+			ECSServiceNameKey:  "Billing",
+			ECSErrorMessageKey: "card expired",
+			ECSErrorTypeKey:    "*errors.errorString",
+			ECSVersionKey:      ECSVersion,
+		}
+		for key, value := range expected {
+			if doc[key] != value {
+				t.Errorf("%s document %s is %v, expected %s\n", pkg, key,
+					doc[key], value)
+			}
+		}
+		if _, err := time.Parse(time.RFC3339Nano,
+			fmt.Sprint(doc[ECSTimestampKey])); err != nil {
+			t.Errorf("%s document timestamp: %s\n", pkg, err.Error())
+		}
+	}
+}
+
+// readGELFMessages reads udp datagrams until count messages are complete
+// chunked messages are reassembled and all messages are gzip decompressed
+func readGELFMessages(t *testing.T, udp net.PacketConn,
+	count int) []map[string]interface{} {
+
+	var msgs []map[string]interface{}
+	chunks := make(map[string][][]byte)
+	buf := make([]byte, 65536)
+	udp.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(msgs) < count {
+		n, _, err := udp.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Failed to read datagram: %s", err.Error())
+		}
+		data := append([]byte(nil), buf[:n]...)
+		if bytes.HasPrefix(data, gelfChunkMagic) {
+			id := string(data[2:10])
+			if chunks[id] == nil {
+				chunks[id] = make([][]byte, data[11])
+			}
+			chunks[id][data[10]] = data[gelfChunkHeaderSize:]
+			var complete []byte
+			for _, chunk := range chunks[id] {
+				if chunk == nil {
+					complete = nil
+					break
+				}
+				complete = append(complete, chunk...)
+			}
+			if complete == nil {
+				continue
+			}
+			delete(chunks, id)
+			data = complete
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to read gzip message: %s", err.Error())
+		}
+		record, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("Failed to decompress message: %s", err.Error())
+		}
+		msg := map[string]interface{}{}
+		if err := json.Unmarshal(record, &msg); err != nil {
+			t.Fatalf("Failed to unmarshal %q: %s", record, err.Error())
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestGELF(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on udp: %s", err.Error())
+	}
+	defer udp.Close()
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on tcp: %s", err.Error())
+	}
+	defer tcp.Close()
+
+	// long enough to be chunked after compression
+	var long strings.Builder
+	for i := 0; long.Len() < 4000; i++ {
+		fmt.Fprintf(&long, "%d ", i*7919%10007)
+	}
+
+	for _, pkg := range []PackageType{ZapType, LogrusType} {
+		for _, network := range []gelfNetworkType{GELFUDP, GELFTCP} {
+			address := udp.LocalAddr().String()
+			if network == GELFTCP {
+				address = tcp.Addr().String()
+			}
+			cfg := LoggerConfiguration{
+				LogPackage:        pkg,
+				LogLevel:          InfoType,
+				EnableCloudEvents: true,
+				CloudEventsCfg:    CloudEventsConfiguration{SetID: CEIncrID},
+				EnableGELF:        true,
+				GELFCfg: GELFConfiguration{
+					Network:   network,
+					Address:   address,
+					Host:      "testhost",
+					ChunkSize: 500,
+					EnableID:  true,
+				},
+			}
+			log, err := NewLogger(cfg)
+			if err != nil {
+				t.Fatalf("Failed to create %s logger: %s", pkg, err.Error())
+			}
+
+			log.WithFields(LogFields{"user": "a", "req id": 2}).Warn("warning")
+			log.Debug("debug")
+			log.Info(long.String())
+
+			var msgs []map[string]interface{}
+			if network == GELFTCP {
+				conn, err := tcp.Accept()
+				if err != nil {
+					t.Fatalf("Failed to accept: %s", err.Error())
+				}
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				reader := bufio.NewReader(conn)
+				for len(msgs) < 2 {
+					frame, err := reader.ReadBytes(0)
+					if err != nil {
+						t.Fatalf("Failed to read frame: %s", err.Error())
+					}
+					msg := map[string]interface{}{}
+					err = json.Unmarshal(frame[:len(frame)-1], &msg)
+					if err != nil {
+						t.Fatalf("Failed to unmarshal %q: %s", frame,
+							err.Error())
+					}
+					msgs = append(msgs, msg)
+				}
+				conn.Close()
+			} else {
+				msgs = readGELFMessages(t, udp, 2)
+			}
+			closeLogger(t, cfg, log)
+
+			expected := []map[string]interface{}{{
+				"version":       GELFVersion,
+				"host":          "testhost",
+				"short_message": "warning",
+				"level":         float64(4),
+				"_user":         "a",
+				"_req_id":       float64(2),
+				"_message_id":   "00000000000000000001",
+			}, {
+				"short_message": long.String(),
+				"level":         float64(6),
+				"_message_id":   "00000000000000000002",
+			}}
+			for i, msg := range msgs {
+				for key, value := range expected[i] {
+					if msg[key] != value {
+						t.Errorf("%s %s message %d %s: %v, expected %v", pkg,
+							network, i, key, msg[key], value)
+					}
+				}
+				if _, ok := msg["timestamp"].(float64); !ok {
+					t.Errorf("%s %s message %d timestamp: %v", pkg, network, i,
+						msg["timestamp"])
+				}
+			}
+		}
+	}
+
+	// chunks must have room for data after the chunk header
+	var errCount int
+	cfg := GELFConfiguration{ChunkSize: gelfChunkHeaderSize}
+	checkGELFConfig(cfg, &errCount)
+	if errCount != 1 {
+		t.Errorf("Found %d configuration errors, expected 1\n", errCount)
+	}
+	gw := &gelfWriter{config: cfg}
+	if _, err := gw.chunk([]byte(long.String())); err == nil {
+		t.Errorf("GELF message chunked with ChunkSize %d\n", cfg.ChunkSize)
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	dir, err := ioutil.TempDir("", "logfmt")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	expected := `level=warn msg="disk full" count=2 empty="" ` +
+		`err="no space" path=/var/log quote="say \"hi\"" ` +
+		`tags="[\"a\",\"b\"]" wait=1.5s x_y=1
+level=info msg=info
+level=error msg="line\nbreak" user=a
+`
+	for _, pkg := range []PackageType{ZapType, LogrusType} {
+		cfg := LoggerConfiguration{
+			LogPackage:   pkg,
+			LogLevel:     InfoType,
+			EnableFile:   true,
+			FileFormat:   LogfmtFormat,
+			FileLocation: filepath.Join(dir, string(pkg)+".log"),
+		}
+		log, err := NewLogger(cfg)
+		if err != nil {
+			t.Fatalf("Failed to create %s logger: %s", pkg, err.Error())
+		}
+
+		log.WithFields(LogFields{"count": 2, "path": "/var/log"}).Warnw(
+			"disk full", "quote", `say "hi"`, "empty", "",
+			"err", errors.New("no space"), "wait", 1500*time.Millisecond,
+			"tags", []string{"a", "b"}, "x=y", 1)
+		log.Debug("debug")
+		log.Info("info")
+		log.WithFields(LogFields{"user": "a"}).Error("line\nbreak")
+		closeLogger(t, cfg, log)
+
+		actual, err := ioutil.ReadFile(cfg.FileLocation)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %s", cfg.FileLocation, err.Error())
+		}
+		if string(actual) != expected {
+			t.Errorf("%s logfmt output:\n%s\nexpected:\n%s", pkg, actual,
+				expected)
+		}
+	}
+}
+
+// otlpCollector provides an in-process otlp collector for grpc and http
+// the first export fails so it is retried
+type otlpCollector struct {
+	collogspb.UnimplementedLogsServiceServer
+	mut      sync.Mutex
+	exports  int
+	metadata []string // x-tenant of each export
+	records  []*logspb.ResourceLogs
+}
+
+// export records a request, returns false for the first request
+func (oc *otlpCollector) export(tenant string,
+	req *collogspb.ExportLogsServiceRequest) bool {
+	oc.mut.Lock()
+	defer oc.mut.Unlock()
+	oc.exports++
+	if oc.exports == 1 {
+		return false
+	}
+	oc.metadata = append(oc.metadata, tenant)
+	oc.records = append(oc.records, req.ResourceLogs...)
+	return true
+}
+
+// Export meets the interface for the grpc logs service
+func (oc *otlpCollector) Export(ctx context.Context,
+	req *collogspb.ExportLogsServiceRequest) (
+	*collogspb.ExportLogsServiceResponse, error) {
+	var tenant string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-tenant"); len(values) > 0 {
+			tenant = values[0]
+		}
+	}
+	if !oc.export(tenant, req) {
+		return nil, status.Error(codes.Unavailable, "starting")
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+// ServeHTTP meets the interface for the http handler
+func (oc *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	req := &collogspb.ExportLogsServiceRequest{}
+	if r.Header.Get("Content-Type") != otlpContentType ||
+		proto.Unmarshal(body, req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !oc.export(r.Header.Get("X-Tenant"), req) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	reply, _ := proto.Marshal(&collogspb.ExportLogsServiceResponse{})
+	w.Header().Set("Content-Type", otlpContentType)
+	w.Write(reply)
+}
+
+func TestOTLPSink(t *testing.T) {
+	if testinit || testenv {
+		t.SkipNow()
+	}
+
+	collector := &otlpCollector{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on tcp: %s", err.Error())
+	}
+	server := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(server, collector)
+	go server.Serve(listener)
+	defer server.Stop()
+	httpServer := httptest.NewServer(collector)
+	defer httpServer.Close()
+
+	traceID := "0102030405060708090a0b0c0d0e0f10"
+	spanID := "0102030405060708"
+	for _, pkg := range []PackageType{ZapType, LogrusType} {
+		for _, protocol := range []otlpProtocolType{OTLPGRPC, OTLPHTTP} {
+			collector.exports = 0
+			collector.metadata = nil
+			collector.records = nil
+			endpoint := listener.Addr().String()
+			if protocol == OTLPHTTP {
+				endpoint = httpServer.URL + "/v1/logs"
+			}
+			cfg := LoggerConfiguration{
+				LogPackage:  pkg,
+				LogLevel:    InfoType,
+				ServiceName: "testservice",
+				EnableOTLP:  true,
+				OTLPCfg: OTLPConfiguration{
+					Protocol:       protocol,
+					Endpoint:       endpoint,
+					Insecure:       true,
+					Headers:        map[string]string{"X-Tenant": "test"},
+					ServiceVersion: "1.2.3",
+					HostName:       "testhost",
+					Resource:       map[string]string{"env": "test"},
+					BatchSize:      3,
+					FlushFreq:      time.Hour,
+					RetryMax:       1,
+					RetryFreq:      10 * time.Millisecond,
+				},
+			}
+			log, err := NewLogger(cfg)
+			if err != nil {
+				t.Fatalf("Failed to create %s logger: %s", pkg, err.Error())
+			}
+			log.WithFields(LogFields{"user": "a", "count": 2,
+				TraceIDKey: traceID, SpanIDKey: spanID,
+				TraceFlagsKey: "01"}).Warn("first")
+			log.Debug("filtered")
+			log.Error("second")
+			closeLogger(t, cfg, log)
+
+			// the failed export is sent again
+			if collector.exports != 2 || len(collector.records) != 1 {
+				t.Fatalf("%s %s got %d exports of %d resources", pkg,
+					protocol, collector.exports, len(collector.records))
+			}
+			if collector.metadata[0] != "test" {
+				t.Errorf("%s %s tenant %q", pkg, protocol,
+					collector.metadata[0])
+			}
+			resource := map[string]string{}
+			for _, kv := range collector.records[0].Resource.Attributes {
+				resource[kv.Key] = kv.Value.GetStringValue()
+			}
+			expected := map[string]string{"service.name": "testservice",
+				"service.version": "1.2.3", "host.name": "testhost",
+				"env": "test"}
+			for key, value := range expected {
+				if resource[key] != value {
+					t.Errorf("%s %s resource %s: %q, expected %q", pkg,
+						protocol, key, resource[key], value)
+				}
+			}
+
+			records := collector.records[0].ScopeLogs[0].LogRecords
+			if len(records) != 2 {
+				t.Fatalf("%s %s got %d log records", pkg, protocol,
+					len(records))
+			}
+			first, second := records[0], records[1]
+			warn := logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+			if first.Body.GetStringValue() != "first" ||
+				first.SeverityNumber != warn ||
+				first.SeverityText != "warn" ||
+				hex.EncodeToString(first.TraceId) != traceID ||
+				hex.EncodeToString(first.SpanId) != spanID ||
+				first.Flags != 1 {
+				t.Errorf("%s %s first record %v", pkg, protocol, first)
+			}
+			attributes := map[string]*commonpb.AnyValue{}
+			for _, kv := range first.Attributes {
+				attributes[kv.Key] = kv.Value
+			}
+			if len(attributes) != 2 ||
+				attributes["user"].GetStringValue() != "a" ||
+				attributes["count"].GetIntValue() != 2 {
+				t.Errorf("%s %s first attributes %v", pkg, protocol,
+					first.Attributes)
+			}
+			severe := logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+			if second.Body.GetStringValue() != "second" ||
+				second.SeverityNumber != severe ||
+				len(second.TraceId) != 0 {
+				t.Errorf("%s %s second record %v", pkg, protocol, second)
+			}
+		}
+	}
+
+	// fatal records are exported before zap exits
+	collector.exports = 0
+	collector.records = nil
+	cfg := LoggerConfiguration{
+		LogPackage: ZapType,
+		LogLevel:   InfoType,
+		EnableOTLP: true,
+		OTLPCfg: OTLPConfiguration{
+			Protocol:  OTLPHTTP,
+			Endpoint:  httpServer.URL + "/v1/logs",
+			BatchSize: 10,
+			FlushFreq: time.Hour,
+			RetryMax:  1,
+			RetryFreq: 10 * time.Millisecond,
+		},
+	}
+	log, err := NewLogger(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create zap logger: %s", err.Error())
+	}
+	writeZapFatal(t, log)
+	collector.mut.Lock()
+	exported := len(collector.records)
+	collector.mut.Unlock()
+	if exported != 1 {
+		t.Errorf("Fatal record not exported before exit\n")
+	}
+	closeLogger(t, cfg, log)
+}
@@ -3,9 +3,13 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -15,12 +19,16 @@ import (
 type logrusLogger struct {
 	logger    *logrus.Logger
 	kafkaHook *LogrusKafkaHook
+	sinks     *logSinks
+	levels    *logrusLevels
 }
 
 // logrusLogEntry provides object for logrus logger with Entry set by WithFields
 type logrusLogEntry struct {
 	entry     *logrus.Entry
 	kafkaHook *LogrusKafkaHook
+	sinks     *logSinks
+	levels    *logrusLevels
 }
 
 // ceFormatter provides wrapper for the JSONFormatter (to insert CE fields)
@@ -35,6 +43,12 @@ func (ce *ceFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	// make a deep copy of entry with the CE fields to format
 	// modifying entry directly would affect other formatters
 	ceEntry := entry.WithFields(ce.fields)
+	if entry.Context != nil {
+		if id, ok := entry.Context.Value(ceIDKey{}).(string); ok {
+			ceEntry.Data[CEIDKey] = id
+		}
+	}
+	ceAddTraceFields(ceEntry.Data)
 	ceEntry.Level = entry.Level
 	ceEntry.Message = entry.Message
 	msg, err := ce.JSONFormatter.Format(ceEntry)
@@ -54,6 +68,12 @@ func getFormatter(format FormatType, config LoggerConfiguration,
 			DisableTimestamp: !config.EnableTimeStamps,
 			TimestampFormat:  time.RFC3339,
 		}
+	case ECSFormat:
+		return newECSFormatter(config)
+	case GELFFormat:
+		return newGELFFormatter(config)
+	case LogfmtFormat:
+		return newLogfmtFormatter(config)
 	case CEFormat:
 		// Change keys for cloudevents
 		fieldmap := logrus.FieldMap{}
@@ -93,11 +113,123 @@ func getFormatter(format FormatType, config LoggerConfiguration,
 	}
 }
 
+// getLogrusLevel converts log level to logrus log level
+func getLogrusLevel(level LevelType) logrus.Level {
+	switch level {
+	case DebugType:
+		return logrus.DebugLevel
+	case WarnType:
+		return logrus.WarnLevel
+	case ErrorType:
+		return logrus.ErrorLevel
+	case FatalType:
+		return logrus.FatalLevel
+	case PanicType:
+		return logrus.PanicLevel
+	case InfoType:
+		fallthrough
+	default:
+		return logrus.InfoLevel
+	}
+}
+
+// getLogrusLevelType converts logrus log level to log level
+func getLogrusLevelType(level logrus.Level) LevelType {
+	switch level {
+	case logrus.TraceLevel, logrus.DebugLevel:
+		return DebugType
+	case logrus.WarnLevel:
+		return WarnType
+	case logrus.ErrorLevel:
+		return ErrorType
+	case logrus.FatalLevel:
+		return FatalType
+	case logrus.PanicLevel:
+		return PanicType
+	case logrus.InfoLevel:
+		fallthrough
+	default:
+		return InfoType
+	}
+}
+
+// logrusLevels provides the log level and the levels of individual sinks
+// the logrus logger level is the most verbose so each sink can filter
+type logrusLevels struct {
+	logger   *logrus.Logger
+	level    uint32 // log level, must access atomically
+	mut      sync.Mutex
+	explicit []logrus.Level // levels of sinks not following the log level
+}
+
+// newLogrusLevels returns the levels set to the log level
+func newLogrusLevels(logger *logrus.Logger,
+	level logrus.Level) *logrusLevels {
+	return &logrusLevels{logger: logger, level: uint32(level)}
+}
+
+// sinkEnabled returns the level check for a sink
+// a sink without a level of its own follows the log level
+func (ll *logrusLevels) sinkEnabled(sinkLevel LevelType) func(
+	logrus.Level) bool {
+
+	if sinkLevel == "" {
+		return func(level logrus.Level) bool {
+			return level <= ll.getLevel()
+		}
+	}
+	fixed := getLogrusLevel(sinkLevel)
+	ll.mut.Lock()
+	ll.explicit = append(ll.explicit, fixed)
+	ll.mut.Unlock()
+	ll.setLevel(ll.getLevel())
+	return func(level logrus.Level) bool {
+		return level <= fixed
+	}
+}
+
+// setLevel changes the log level, sinks with their own level are unchanged
+func (ll *logrusLevels) setLevel(level logrus.Level) {
+	ll.mut.Lock()
+	defer ll.mut.Unlock()
+
+	atomic.StoreUint32(&ll.level, uint32(level))
+	verbose := level
+	for _, sinkLevel := range ll.explicit {
+		if sinkLevel > verbose {
+			verbose = sinkLevel
+		}
+	}
+	ll.logger.SetLevel(verbose)
+}
+
+// getLevel returns the log level
+func (ll *logrusLevels) getLevel() logrus.Level {
+	return logrus.Level(atomic.LoadUint32(&ll.level))
+}
+
+// levelFormatter formats only the entries its sink is enabled for
+// an empty message is returned for other entries
+type levelFormatter struct {
+	logrus.Formatter
+	enabled func(level logrus.Level) bool
+}
+
+// Format meets the interface for the logrus formatter
+func (lf *levelFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if !lf.enabled(entry.Level) {
+		return nil, nil
+	}
+	return lf.Formatter.Format(entry)
+}
+
 // newLogrusLogger return a logrus logger instance
 func newLogrusLogger(config LoggerConfiguration) (Logger, error) {
 	var kafkaHook *LogrusKafkaHook
 	var cloudEvents *CloudEvents
 	var fields LogFields
+	var fwriter io.Writer
+	sinks := &logSinks{}
 
 	logLevel := config.LogLevel
 	if logLevel == "" {
@@ -123,34 +255,57 @@ func newLogrusLogger(config LoggerConfiguration) (Logger, error) {
 		fields = cloudEvents.fields
 	}
 
-	if config.EnableFile {
-		var fwriter io.Writer
-		var err error
-		fileLocation := config.FileLocation
-		if fileLocation == "" {
-			fileLocation = defaultLoggerConfiguration.FileLocation
+	levels := newLogrusLevels(lLogger, level)
+
+	// the id hook must be added first so the id is set for every sink
+	var idHook *LogrusCEIDHook
+	if ceSharedIDs(config) {
+		idHook = newLogrusCEIDHook(cloudEvents)
+		lLogger.Hooks.Add(idHook)
+	}
+
+	// sinkFormatter returns the formatter for a sink filtered by its level
+	sinkFormatter := func(format FormatType,
+		sinkLevel LevelType) *levelFormatter {
+		formatter := &levelFormatter{
+			getFormatter(format, config, fields),
+			levels.sinkEnabled(sinkLevel),
 		}
-		if config.EnableRotation {
-			fwriter = rotationLogger(fileLocation, config.RotationCfg)
-		} else {
-			fwriter, err = os.OpenFile(fileLocation,
-				os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			if err != nil {
-				return nil, err
-			}
+		if idHook != nil && ceIDFormat(config, format) {
+			idHook.addSink(formatter.enabled)
 		}
-		lLogger.SetOutput(fwriter)
-		lLogger.SetFormatter(getFormatter(config.FileFormat, config, fields))
-	} else if config.EnableConsole {
-		var cwriter io.Writer
-		if debugCapture != nil {
-			cwriter = debugCapture
-		} else if config.ConsoleWriter == Stderr {
-			cwriter = os.Stderr
-		} else {
-			cwriter = os.Stdout
+		return formatter
+	}
+
+	if config.EnableKafka {
+		formatter := sinkFormatter(config.KafkaFormat, config.KafkaLevel)
+		kafkaHook, err = newLogrusKafkaHook(config.KafkaProducerCfg,
+			cloudEvents, config.CloudEventsCfg, formatter)
+		if err != nil {
+			return nil, sinks.abort(err)
+		}
+		if layout := newKafkaLayout(config, cloudEvents); layout != nil {
+			kafkaHook.setLayout(layout, formatter.enabled)
+		}
+		// add the hook
+		sinks.add(kafkaHook)
+		lLogger.Hooks.Add(kafkaHook)
+	}
+
+	if config.EnableFile {
+		fwriter, err = getFileWriter(config)
+		if err != nil {
+			return nil, sinks.abort(err)
 		}
-		formatter := getFormatter(config.ConsoleFormat, config, fields)
+		sinks.add(fileSink{fwriter})
+		lLogger.SetOutput(fwriter)
+		lLogger.SetFormatter(sinkFormatter(config.FileFormat,
+			config.FileLevel))
+	}
+
+	if config.EnableConsole {
+		cwriter := getConsoleWriter(config)
+		formatter := sinkFormatter(config.ConsoleFormat, config.ConsoleLevel)
 		if config.EnableFile {
 			// use hook to provide separate formatting for console
 			hook := newLogrusConsoleHook(cwriter, formatter)
@@ -162,15 +317,67 @@ func newLogrusLogger(config LoggerConfiguration) (Logger, error) {
 		}
 	}
 
-	if config.EnableKafka {
-		formatter := getFormatter(config.KafkaFormat, config, fields)
-		kafkaHook, err = newLogrusKafkaHook(config.KafkaProducerCfg,
-			cloudEvents, config.CloudEventsCfg, formatter)
+	if config.EnableSyslog {
+		swriter, err := newSyslogWriter(config.SyslogCfg)
 		if err != nil {
-			return nil, err
+			return nil, sinks.abort(err)
 		}
-		// add the hook
-		lLogger.Hooks.Add(kafkaHook)
+		sinks.add(swriter)
+		hook := newLogrusMessageHook(swriter,
+			levels.sinkEnabled(config.SyslogLevel))
+		lLogger.Hooks.Add(hook)
+	}
+
+	if config.EnableHTTP {
+		format := getHTTPFormat(config.HTTPFormat)
+		hwriter := newHTTPWriter(config.HTTPCfg, format)
+		sinks.add(hwriter)
+		hook := newLogrusHTTPHook(hwriter,
+			sinkFormatter(format, config.HTTPLevel))
+		lLogger.Hooks.Add(hook)
+	}
+
+	if config.EnableLoki {
+		lwriter := newLokiWriter(config.LokiCfg)
+		sinks.add(lwriter)
+		hook := newLogrusRecordHook(lwriter,
+			sinkFormatter(config.LokiFormat, config.LokiLevel))
+		lLogger.Hooks.Add(hook)
+	}
+
+	if config.EnableElastic {
+		ewriter := newElasticWriter(config.ElasticCfg, getServiceName(config))
+		sinks.add(ewriter)
+		hook := newLogrusRecordHook(ewriter,
+			sinkFormatter(getElasticFormat(config.ElasticFormat),
+				config.ElasticLevel))
+		lLogger.Hooks.Add(hook)
+	}
+
+	if config.EnableGELF {
+		gwriter, err := newGELFWriter(config.GELFCfg)
+		if err != nil {
+			return nil, sinks.abort(err)
+		}
+		sinks.add(gwriter)
+		hook := newLogrusConsoleHook(gwriter,
+			sinkFormatter(GELFFormat, config.GELFLevel))
+		lLogger.Hooks.Add(hook)
+	}
+
+	if config.EnableOTLP {
+		owriter, err := newOTLPWriter(config.OTLPCfg, getServiceName(config))
+		if err != nil {
+			return nil, sinks.abort(err)
+		}
+		sinks.add(owriter)
+		hook := newLogrusMessageHook(owriter,
+			levels.sinkEnabled(config.OTLPLevel))
+		lLogger.Hooks.Add(hook)
+	}
+
+	if kafkaHook != nil {
+		kafkaHook.kp.setFallback(getFallbackWriter(config, fwriter))
 	}
 
 	if config.EnableDebug {
@@ -182,6 +389,8 @@ func newLogrusLogger(config LoggerConfiguration) (Logger, error) {
 	return &logrusLogger{
 		logger:    lLogger,
 		kafkaHook: kafkaHook,
+		sinks:     sinks,
+		levels:    levels,
 	}, nil
 }
 
@@ -271,23 +480,95 @@ func (l *logrusLogger) Panicln(args ...interface{}) {
 	l.logger.Panicln(args...)
 }
 
+func (l *logrusLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(convertKeysAndValues(keysAndValues)).Debug(msg)
+}
+
+func (l *logrusLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(convertKeysAndValues(keysAndValues)).Info(msg)
+}
+
+func (l *logrusLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(convertKeysAndValues(keysAndValues)).Warn(msg)
+}
+
+func (l *logrusLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(convertKeysAndValues(keysAndValues)).Error(msg)
+}
+
+func (l *logrusLogger) Fatalw(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(convertKeysAndValues(keysAndValues)).Fatal(msg)
+}
+
+func (l *logrusLogger) Panicw(msg string, keysAndValues ...interface{}) {
+	l.logger.WithFields(convertKeysAndValues(keysAndValues)).Panic(msg)
+}
+
 // WithFields adds more fields to logger, uses logrusLogEntry
 func (l *logrusLogger) WithFields(fields LogFields) Logger {
 	return &logrusLogEntry{
-		entry: l.logger.WithFields(convertToLogrusFields(fields)),
+		entry:     l.logger.WithFields(convertToLogrusFields(fields)),
+		kafkaHook: l.kafkaHook,
+		sinks:     l.sinks,
+		levels:    l.levels,
 	}
 }
 
-// WithKafkaFilterFn adds a filter function for each kafka record
+// WithContext adds the fields extracted from ctx to each log record
+func (l *logrusLogger) WithContext(ctx context.Context) Logger {
+	return withContext(l, ctx)
+}
+
+// WithKafkaFilterFn returns a logger adding a filter function for each of
+// its kafka records
 func (l *logrusLogger) WithKafkaFilterFn(filterFn FilterFunc) Logger {
-	l.kafkaHook.kp.config.filterFn = filterFn
-	return l
+	entry := &logrusLogEntry{
+		entry:     logrus.NewEntry(l.logger),
+		kafkaHook: l.kafkaHook,
+		sinks:     l.sinks,
+		levels:    l.levels,
+	}
+	return entry.WithKafkaFilterFn(filterFn)
 }
 
-// WithKafkaKeyFn adds a key function for each kafka record
+// WithKafkaKeyFn returns a logger using a key function for its kafka records
 func (l *logrusLogger) WithKafkaKeyFn(keyFn KeyFunc) Logger {
-	l.kafkaHook.kp.config.keyFn = keyFn
-	return l
+	entry := &logrusLogEntry{
+		entry:     logrus.NewEntry(l.logger),
+		kafkaHook: l.kafkaHook,
+		sinks:     l.sinks,
+		levels:    l.levels,
+	}
+	return entry.WithKafkaKeyFn(keyFn)
+}
+
+// SetLevel changes the log level of this and all related loggers
+// sinks configured with a level of their own are not affected
+func (l *logrusLogger) SetLevel(level LevelType) {
+	l.levels.setLevel(getLogrusLevel(level))
+}
+
+// GetLevel returns the current log level
+func (l *logrusLogger) GetLevel() LevelType {
+	return getLogrusLevelType(l.levels.getLevel())
+}
+
+// KafkaStats returns the kafka producer message counters
+func (l *logrusLogger) KafkaStats() ProducerStats {
+	if l.kafkaHook == nil {
+		return ProducerStats{}
+	}
+	return l.kafkaHook.kp.Stats()
+}
+
+// Sync flushes the file and kafka sinks
+func (l *logrusLogger) Sync() error {
+	return l.sinks.sync()
+}
+
+// Close flushes and releases all sinks, kafka is drained until ctx is done
+func (l *logrusLogger) Close(ctx context.Context) error {
+	return l.sinks.close(ctx)
 }
 
 func (l *logrusLogEntry) Print(args ...interface{}) {
@@ -374,23 +655,96 @@ func (l *logrusLogEntry) Panicln(args ...interface{}) {
 	l.entry.Panicln(args...)
 }
 
+func (l *logrusLogEntry) Debugw(msg string, keysAndValues ...interface{}) {
+	l.entry.WithFields(convertKeysAndValues(keysAndValues)).Debug(msg)
+}
+
+func (l *logrusLogEntry) Infow(msg string, keysAndValues ...interface{}) {
+	l.entry.WithFields(convertKeysAndValues(keysAndValues)).Info(msg)
+}
+
+func (l *logrusLogEntry) Warnw(msg string, keysAndValues ...interface{}) {
+	l.entry.WithFields(convertKeysAndValues(keysAndValues)).Warn(msg)
+}
+
+func (l *logrusLogEntry) Errorw(msg string, keysAndValues ...interface{}) {
+	l.entry.WithFields(convertKeysAndValues(keysAndValues)).Error(msg)
+}
+
+func (l *logrusLogEntry) Fatalw(msg string, keysAndValues ...interface{}) {
+	l.entry.WithFields(convertKeysAndValues(keysAndValues)).Fatal(msg)
+}
+
+func (l *logrusLogEntry) Panicw(msg string, keysAndValues ...interface{}) {
+	l.entry.WithFields(convertKeysAndValues(keysAndValues)).Panic(msg)
+}
+
 // WithFields adds more fields to logger with Entry
 func (l *logrusLogEntry) WithFields(fields LogFields) Logger {
 	return &logrusLogEntry{
-		entry: l.entry.WithFields(convertToLogrusFields(fields)),
+		entry:     l.entry.WithFields(convertToLogrusFields(fields)),
+		kafkaHook: l.kafkaHook,
+		sinks:     l.sinks,
+		levels:    l.levels,
 	}
 }
 
-// WithKafkaFilterFn adds a filter function for each kafka record
+// WithContext adds the fields extracted from ctx to each log record
+func (l *logrusLogEntry) WithContext(ctx context.Context) Logger {
+	return withContext(l, ctx)
+}
+
+// WithKafkaFilterFn returns a logger adding a filter function for each of
+// its kafka records, after those of this logger
 func (l *logrusLogEntry) WithKafkaFilterFn(filterFn FilterFunc) Logger {
-	l.kafkaHook.kp.config.filterFn = filterFn
-	return l
+	funcs := getKafkaFuncs(l.entry.Context).withFilter(filterFn)
+	return l.withKafkaFuncs(funcs)
 }
 
-// WithKafkaKeyFn adds a key function for each kafka record
+// WithKafkaKeyFn returns a logger using a key function for its kafka records
 func (l *logrusLogEntry) WithKafkaKeyFn(keyFn KeyFunc) Logger {
-	l.kafkaHook.kp.config.keyFn = keyFn
-	return l
+	funcs := getKafkaFuncs(l.entry.Context).withKey(keyFn)
+	return l.withKafkaFuncs(funcs)
+}
+
+// withKafkaFuncs returns a logger with an entry context carrying funcs
+// the kafka hook reads them from the context of each entry
+func (l *logrusLogEntry) withKafkaFuncs(funcs *kafkaFuncs) Logger {
+	return &logrusLogEntry{
+		entry:     l.entry.WithContext(withKafkaFuncs(l.entry.Context, funcs)),
+		kafkaHook: l.kafkaHook,
+		sinks:     l.sinks,
+		levels:    l.levels,
+	}
+}
+
+// SetLevel changes the log level of this and all related loggers
+// sinks configured with a level of their own are not affected
+func (l *logrusLogEntry) SetLevel(level LevelType) {
+	l.levels.setLevel(getLogrusLevel(level))
+}
+
+// GetLevel returns the current log level
+func (l *logrusLogEntry) GetLevel() LevelType {
+	return getLogrusLevelType(l.levels.getLevel())
+}
+
+// KafkaStats returns the kafka producer message counters
+func (l *logrusLogEntry) KafkaStats() ProducerStats {
+	if l.kafkaHook == nil {
+		return ProducerStats{}
+	}
+	return l.kafkaHook.kp.Stats()
+}
+
+// Sync flushes the file and kafka sinks
+func (l *logrusLogEntry) Sync() error {
+	return l.sinks.sync()
+}
+
+// Close flushes and releases all sinks, kafka is drained until ctx is done
+func (l *logrusLogEntry) Close(ctx context.Context) error {
+	return l.sinks.close(ctx)
 }
 
 // convertToLogrusFields converts fields to logrus type
@@ -401,3 +755,21 @@ func convertToLogrusFields(fields LogFields) logrus.Fields {
 	}
 	return logrusFields
 }
+
+// convertKeysAndValues converts alternating keys and values to logrus type
+// non-string keys are formatted and a key without a value is set to nil
+func convertKeysAndValues(keysAndValues []interface{}) logrus.Fields {
+	logrusFields := make(logrus.Fields, len(keysAndValues)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		if i+1 < len(keysAndValues) {
+			logrusFields[key] = keysAndValues[i+1]
+		} else {
+			logrusFields[key] = nil
+		}
+	}
+	return logrusFields
+}
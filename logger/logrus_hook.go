@@ -3,10 +3,14 @@
 package logger
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/sirupsen/logrus"
 )
@@ -16,7 +20,12 @@ type LogrusKafkaHook struct {
 	kp        *KafkaProducer
 	ce        *CloudEvents
 	formatter logrus.Formatter
+	layout    *kafkaLayout // if set entries are sent as fields
+	enabled   func(level logrus.Level) bool
 	levels    []logrus.Level
+	closed    int32         // Nonzero if closing, must access atomically
+	pending   pendingWrites // messages not yet passed to the producer
+	closeMut  sync.Mutex
 }
 
 // newLogrusKafkaHook returns a kafka producer hook instance
@@ -45,18 +54,112 @@ func (h *LogrusKafkaHook) Levels() []logrus.Level {
 	return h.levels
 }
 
+// setLayout sends the fields of entries the sink is enabled for instead of
+// formatted entries, used for layouts of json and cloudevents formats
+func (h *LogrusKafkaHook) setLayout(layout *kafkaLayout,
+	enabled func(level logrus.Level) bool) {
+	h.layout = layout
+	h.enabled = enabled
+	h.kp.setLayout(layout)
+}
+
 // Fire writes the entry as a message on Kafka
 func (h *LogrusKafkaHook) Fire(entry *logrus.Entry) error {
+	if h.Closed() {
+		return syscall.EINVAL
+	}
+
+	if h.layout != nil {
+		return h.fireFields(entry)
+	}
+
 	msg, err := h.formatter.Format(entry)
 	if err != nil {
 		return err
 	}
+	if msg == nil {
+		// filtered by the kafka level
+		return nil
+	}
+
+	if h.kp.producer == nil {
+		return errors.New("No producer defined")
+	}
+
+	epoch := h.pending.start()
+	defer h.pending.done(epoch)
+
+	return h.kp.sendMessage(msg, getKafkaFuncs(entry.Context))
+}
+
+// fireFields sends the fields of the entry as the logrus json formatter
+// would write them, errors as strings and fields clashing with the time,
+// level and message keys prefixed with fields.
+func (h *LogrusKafkaHook) fireFields(entry *logrus.Entry) error {
+	if !h.enabled(entry.Level) {
+		return nil
+	}
+
+	msgMap := make(map[string]interface{}, len(entry.Data)+8)
+	for key, value := range entry.Data {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		msgMap[key] = value
+	}
+	for _, key := range []string{logrus.FieldKeyTime, h.layout.levelKey,
+		h.layout.messageKey, logrus.FieldKeyLogrusError} {
+		if value, ok := msgMap[key]; ok {
+			msgMap["fields."+key] = value
+			delete(msgMap, key)
+		}
+	}
+	if h.layout.fields != nil && entry.Context != nil {
+		if id, ok := entry.Context.Value(ceIDKey{}).(string); ok {
+			msgMap[CEIDKey] = id
+		}
+	}
+	h.layout.record(entry.Level.String(), entry.Time, entry.Message, msgMap)
 
 	if h.kp.producer == nil {
 		return errors.New("No producer defined")
 	}
 
-	return h.kp.sendMessage(msg)
+	epoch := h.pending.start()
+	defer h.pending.done(epoch)
+
+	return h.kp.sendFields(msgMap, getKafkaFuncs(entry.Context))
+}
+
+// Sync waits for pending messages to be acked or failed by the producer
+func (h *LogrusKafkaHook) Sync() error {
+	h.pending.wait()
+	return h.kp.sync()
+}
+
+// Closed returns true if the hook is closed, false otherwise (Thread-safe)
+func (h *LogrusKafkaHook) Closed() bool {
+	return atomic.LoadInt32(&h.closed) != 0
+}
+
+// Close must be called when the hook is no longer needed (Thread-safe)
+func (h *LogrusKafkaHook) Close() error {
+	return h.closeContext(context.Background())
+}
+
+// closeContext waits for pending messages then drains the producer until ctx done
+func (h *LogrusKafkaHook) closeContext(ctx context.Context) error {
+	h.closeMut.Lock()
+	defer h.closeMut.Unlock()
+
+	if h.Closed() {
+		return syscall.EINVAL
+	}
+
+	atomic.StoreInt32(&h.closed, 1)
+
+	h.pending.wait()
+	return h.kp.close(ctx)
 }
 
 // LogrusConsoleHook provides a console hook
@@ -92,6 +195,118 @@ func (h *LogrusConsoleHook) Fire(entry *logrus.Entry) error {
 	return nil
 }
 
+// LogrusRecordHook provides a hook for sinks that need the level, time and
+// fields of each entry as well as the formatted entry
+type LogrusRecordHook struct {
+	writer    recordWriter
+	formatter logrus.Formatter
+}
+
+// newLogrusRecordHook returns a record hook instance
+func newLogrusRecordHook(writer recordWriter,
+	fmt logrus.Formatter) *LogrusRecordHook {
+	return &LogrusRecordHook{
+		writer:    writer,
+		formatter: fmt,
+	}
+}
+
+// Levels returns all log levels that are enabled
+func (h *LogrusRecordHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire formats the entry and passes it to the writer
+func (h *LogrusRecordHook) Fire(entry *logrus.Entry) error {
+	msg, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		// filtered by the sink level
+		return nil
+	}
+	return h.writer.write(getLogrusLevelType(entry.Level), entry.Time, msg,
+		entry.Data)
+}
+
+// LogrusMessageHook provides a hook for sinks that need the level, time,
+// message and fields of each entry instead of the formatted entry
+type LogrusMessageHook struct {
+	writer  messageWriter
+	enabled func(level logrus.Level) bool
+}
+
+// newLogrusMessageHook returns a message hook instance
+func newLogrusMessageHook(writer messageWriter,
+	enabled func(level logrus.Level) bool) *LogrusMessageHook {
+	return &LogrusMessageHook{
+		writer:  writer,
+		enabled: enabled,
+	}
+}
+
+// Levels returns all log levels that are enabled
+func (h *LogrusMessageHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire passes the entry to the writer if the sink level is enabled
+func (h *LogrusMessageHook) Fire(entry *logrus.Entry) error {
+	if !h.enabled(entry.Level) {
+		return nil
+	}
+	return h.writer.write(getLogrusLevelType(entry.Level), entry.Time,
+		entry.Message, entry.Data)
+}
+
+// ceIDKey provides the entry context key for the cloudevents id
+type ceIDKey struct{}
+
+// LogrusCEIDHook provides a hook giving each entry one cloudevents id
+// that the formatters of all sinks with cloudevents format use
+type LogrusCEIDHook struct {
+	cloudEvents *CloudEvents
+	enabled     []func(level logrus.Level) bool
+}
+
+// newLogrusCEIDHook returns a cloudevents id hook instance
+func newLogrusCEIDHook(cloudEvents *CloudEvents) *LogrusCEIDHook {
+	return &LogrusCEIDHook{
+		cloudEvents: cloudEvents,
+	}
+}
+
+// addSink adds the level check of a sink with cloudevents format
+func (h *LogrusCEIDHook) addSink(enabled func(level logrus.Level) bool) {
+	h.enabled = append(h.enabled, enabled)
+}
+
+// Levels returns all log levels that are enabled
+func (h *LogrusCEIDHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire sets the id in the entry context if any cloudevents sink logs it
+func (h *LogrusCEIDHook) Fire(entry *logrus.Entry) error {
+	for _, enabled := range h.enabled {
+		if !enabled(entry.Level) {
+			continue
+		}
+		id, err := h.cloudEvents.ceRecordID(entry.Message)
+		if err != nil || id == "" {
+			return err
+		}
+		ctx := entry.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		entry.Context = context.WithValue(ctx, ceIDKey{}, id)
+		return nil
+	}
+	return nil
+}
+
 // LogrusDebugHook provides a debug hook
 type LogrusDebugHook struct{}
 
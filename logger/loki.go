@@ -0,0 +1,294 @@
+package logger
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// lokiEncodingType provides loki push request encoding type
+type lokiEncodingType string
+
+// Types of loki push request encodings
+const (
+	LokiProtobuf lokiEncodingType = "protobuf" // default - snappy compressed
+	LokiJSON     lokiEncodingType = "json"
+)
+
+// Labels added to every loki stream
+const (
+	LokiServiceLabel = "service"
+	LokiLevelLabel   = "level"
+)
+
+// Content types for loki push requests
+const (
+	lokiProtobufContentType = "application/x-protobuf"
+	lokiJSONContentType     = "application/json"
+)
+
+// lokiTenantHeader is the header selecting the tenant of a multi-tenant loki
+const lokiTenantHeader = "X-Scope-OrgID"
+
+// lokiStreamAge is how long the last entry time of an idle stream is kept
+// loki rejects entries over an hour older than the newest of their stream
+const lokiStreamAge = time.Hour
+
+// LokiConfiguration provides loki sink configuration type
+type LokiConfiguration struct {
+	URL          string // push endpoint, ends with /loki/api/v1/push
+	Encoding     lokiEncodingType
+	TenantID     string            // sent as X-Scope-OrgID if set
+	Service      string            // service label, defaults to program name
+	Labels       map[string]string // static labels
+	LabelKeys    []string          // LogFields keys added as labels
+	Headers      map[string]string
+	BearerToken  string
+	Username     string // basic auth, ignored if BearerToken set
+	Password     string
+	BatchSize    int           // entries pushed when the batch is full
+	FlushFreq    time.Duration // or when the batch is this old
+	QueueSize    int           // batches waiting to be pushed
+	Timeout      time.Duration // per request
+	RetryMax     int           // retries for 429 and 5xx responses
+	RetryFreq    time.Duration // first backoff, doubled for each retry
+	TLSCfg       *tls.Config   `json:"-" yaml:"-"`
+	ErrorHandler ErrorFunc     `json:"-" yaml:"-"` // called with URL and body
+}
+
+// lokiWriter groups entries into streams by label and pushes them to loki
+type lokiWriter struct {
+	*httpWriter
+	config   LokiConfiguration
+	lastTime map[string]time.Time // last pushed entry of each stream
+	pruned   time.Time            // when idle streams were last removed
+}
+
+// lokiStream provides the entries of a batch with the same labels
+type lokiStream struct {
+	key     string
+	labels  map[string]string
+	records []httpRecord
+}
+
+// newLokiWriter returns a loki writer instance
+func newLokiWriter(config LokiConfiguration) *lokiWriter {
+	lw := &lokiWriter{
+		config:   config,
+		lastTime: make(map[string]time.Time),
+	}
+	if config.URL == "" {
+		lw.config.URL = defaultLokiConfiguration.URL
+	}
+	if config.Encoding == "" {
+		lw.config.Encoding = defaultLokiConfiguration.Encoding
+	}
+	if config.Service == "" {
+		lw.config.Service = filepath.Base(os.Args[0])
+	}
+
+	headers := make(map[string]string)
+	for key, value := range config.Headers {
+		headers[key] = value
+	}
+	if config.TenantID != "" {
+		headers[lokiTenantHeader] = config.TenantID
+	}
+
+	contentType := lokiProtobufContentType
+	if lw.config.Encoding == LokiJSON {
+		contentType = lokiJSONContentType
+	}
+
+	lw.httpWriter = newBatchWriter(HTTPConfiguration{
+		URL:          lw.config.URL,
+		Headers:      headers,
+		BearerToken:  config.BearerToken,
+		Username:     config.Username,
+		Password:     config.Password,
+		BatchSize:    config.BatchSize,
+		FlushFreq:    config.FlushFreq,
+		QueueSize:    config.QueueSize,
+		Timeout:      config.Timeout,
+		RetryMax:     config.RetryMax,
+		RetryFreq:    config.RetryFreq,
+		TLSCfg:       config.TLSCfg,
+		ErrorHandler: config.ErrorHandler,
+	}, contentType, lw.encode)
+	return lw
+}
+
+// write adds an entry with the labels of the level and fields to the batch
+func (lw *lokiWriter) write(level LevelType, t time.Time, line []byte,
+	fields map[string]interface{}) error {
+
+	labels := make(map[string]string, len(lw.config.Labels)+
+		len(lw.config.LabelKeys)+2)
+	for name, value := range lw.config.Labels {
+		labels[lokiLabelName(name)] = value
+	}
+	for _, key := range lw.config.LabelKeys {
+		if value, ok := fields[key]; ok {
+			labels[lokiLabelName(key)] = fmt.Sprint(value)
+		}
+	}
+	labels[LokiServiceLabel] = lw.config.Service
+	labels[LokiLevelLabel] = string(level)
+
+	// encoders reuse their buffers so the line is copied
+	line = append([]byte(nil), bytes.TrimRight(line, "\n")...)
+	return lw.add(httpRecord{line: line, time: t, labels: labels})
+}
+
+// encode returns the push request for a batch, called only by the sender
+// entries of a stream are sorted and never older than the last pushed entry
+// so loki does not reject them as out of order
+func (lw *lokiWriter) encode(batch []httpRecord) ([]httpBody, error) {
+	var streams []*lokiStream
+	byKey := make(map[string]*lokiStream)
+	for _, record := range batch {
+		key := lokiLabelString(record.labels)
+		stream, ok := byKey[key]
+		if !ok {
+			stream = &lokiStream{key: key, labels: record.labels}
+			byKey[key] = stream
+			streams = append(streams, stream)
+		}
+		stream.records = append(stream.records, record)
+	}
+
+	for _, stream := range streams {
+		sort.SliceStable(stream.records, func(i, j int) bool {
+			return stream.records[i].time.Before(stream.records[j].time)
+		})
+		last := lw.lastTime[stream.key]
+		for i := range stream.records {
+			if stream.records[i].time.Before(last) {
+				stream.records[i].time = last
+			}
+			last = stream.records[i].time
+		}
+		lw.lastTime[stream.key] = last
+	}
+	lw.prune(time.Now())
+
+	var data []byte
+	var err error
+	if lw.config.Encoding == LokiJSON {
+		data, err = lokiJSONRequest(streams)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		data = snappy.Encode(nil, lokiProtobufRequest(streams))
+	}
+	return []httpBody{{data, len(batch)}}, nil
+}
+
+// prune removes the streams without entries for lokiStreamAge, so label
+// values that are no longer used do not hold memory
+func (lw *lokiWriter) prune(now time.Time) {
+	if now.Sub(lw.pruned) < lokiStreamAge {
+		return
+	}
+	for key, last := range lw.lastTime {
+		if now.Sub(last) > lokiStreamAge {
+			delete(lw.lastTime, key)
+		}
+	}
+	lw.pruned = now
+}
+
+// lokiJSONRequest returns the JSON push request for the streams
+// {"streams":[{"stream":{labels},"values":[["<unix ns>","<line>"]]}]}
+func lokiJSONRequest(streams []*lokiStream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	request := struct {
+		Streams []jsonStream `json:"streams"`
+	}{}
+	for _, stream := range streams {
+		js := jsonStream{Stream: stream.labels}
+		for _, record := range stream.records {
+			js.Values = append(js.Values, [2]string{
+				strconv.FormatInt(record.time.UnixNano(), 10),
+				string(record.line),
+			})
+		}
+		request.Streams = append(request.Streams, js)
+	}
+	return json.Marshal(request)
+}
+
+// lokiProtobufRequest returns the protobuf push request for the streams
+// PushRequest{streams=1}, StreamAdapter{labels=1, entries=2},
+// EntryAdapter{timestamp=1, line=2}, Timestamp{seconds=1, nanos=2}
+func lokiProtobufRequest(streams []*lokiStream) []byte {
+	var request []byte
+	for _, stream := range streams {
+		var msg []byte
+		msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+		msg = protowire.AppendString(msg, stream.key)
+		for _, record := range stream.records {
+			var ts []byte
+			ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(record.time.Unix()))
+			ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(record.time.Nanosecond()))
+
+			var entry []byte
+			entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+			entry = protowire.AppendBytes(entry, ts)
+			entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+			entry = protowire.AppendBytes(entry, record.line)
+
+			msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+			msg = protowire.AppendBytes(msg, entry)
+		}
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, msg)
+	}
+	return request
+}
+
+// lokiLabelString returns the labels in stream selector form
+// {name="value", ...} sorted by name
+func lokiLabelString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(labels[name])
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// lokiLabelName returns a valid label name, invalid characters become _
+func lokiLabelName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(i > 0 && r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,388 @@
+package logger
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpProtocolType provides otlp exporter protocol type
+type otlpProtocolType string
+
+// Types of otlp exporter protocols
+const (
+	OTLPGRPC otlpProtocolType = "grpc" // default
+	OTLPHTTP otlpProtocolType = "http/protobuf"
+)
+
+// Resource attributes of exported logs
+const (
+	OTLPServiceNameKey    = "service.name"
+	OTLPServiceVersionKey = "service.version"
+	OTLPHostNameKey       = "host.name"
+)
+
+// otlpScopeName is the instrumentation scope name of exported logs
+const otlpScopeName = "github.com/pavedroad-io/go-core/logger"
+
+// otlpExportMethod is the grpc method of the logs service
+const otlpExportMethod = "/" + otlpServiceName + "/Export"
+
+// otlpServiceName is the grpc service name of the logs service
+const otlpServiceName = "opentelemetry.proto.collector.logs.v1.LogsService"
+
+// otlpContentType is the content type of otlp/http protobuf requests
+const otlpContentType = "application/x-protobuf"
+
+// otlpDefaultHTTPEndpoint is the endpoint if http/protobuf is not configured
+const otlpDefaultHTTPEndpoint = "http://localhost:4318/v1/logs"
+
+// OTLPConfiguration provides opentelemetry logs exporter configuration
+type OTLPConfiguration struct {
+	Protocol       otlpProtocolType
+	Endpoint       string            // host:port for grpc, URL for http
+	Insecure       bool              // grpc without TLS
+	Headers        map[string]string // grpc metadata or http headers
+	ServiceVersion string            // service.version if set
+	HostName       string            // host.name, defaults to the host name
+	Resource       map[string]string // other resource attributes
+	BatchSize      int               // records sent when the batch is full
+	FlushFreq      time.Duration     // or when the batch is this old
+	QueueSize      int               // batches waiting to be exported
+	Timeout        time.Duration     // per request
+	RetryMax       int               // retries for retryable failures
+	RetryFreq      time.Duration     // first backoff, doubled for each retry
+	TLSCfg         *tls.Config       `json:"-" yaml:"-"`
+	ErrorHandler   ErrorFunc         `json:"-" yaml:"-"` // endpoint and body
+}
+
+// getOTLPSeverity converts log level to opentelemetry severity number
+func getOTLPSeverity(level LevelType) logspb.SeverityNumber {
+	switch level {
+	case DebugType:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case WarnType:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case ErrorType:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	case FatalType:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL
+	case PanicType:
+		// panic is more severe than fatal as for syslog
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL2
+	case InfoType:
+		fallthrough
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	}
+}
+
+// otlpWriter converts records to log records and exports them in batches
+type otlpWriter struct {
+	*httpWriter
+	conn     *grpc.ClientConn // nil for http/protobuf
+	resource []byte           // encoded resource of every request
+	scope    []byte           // encoded instrumentation scope
+}
+
+// otlpRawCodec passes encoded requests and responses through grpc
+// so both protocols share the request encoding and response check
+type otlpRawCodec struct{}
+
+// Marshal meets the interface for the grpc codec
+func (otlpRawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+// Unmarshal meets the interface for the grpc codec
+func (otlpRawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+// Name meets the interface for the grpc codec
+func (otlpRawCodec) Name() string {
+	return "proto"
+}
+
+// newOTLPWriter returns an otlp writer instance
+// grpc connects when the first batch is exported
+func newOTLPWriter(config OTLPConfiguration,
+	service string) (*otlpWriter, error) {
+
+	protocol := config.Protocol
+	if protocol == "" {
+		protocol = defaultOTLPConfiguration.Protocol
+	}
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = defaultOTLPConfiguration.Endpoint
+		if protocol == OTLPHTTP {
+			endpoint = otlpDefaultHTTPEndpoint
+		}
+	}
+
+	resource, err := otlpResource(config, service)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := proto.Marshal(&commonpb.InstrumentationScope{
+		Name: otlpScopeName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ow := &otlpWriter{resource: resource, scope: scope}
+
+	if protocol == OTLPGRPC {
+		creds := insecure.NewCredentials()
+		if !config.Insecure {
+			creds = credentials.NewTLS(config.TLSCfg)
+		}
+		ow.conn, err = grpc.NewClient(endpoint,
+			grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ow.httpWriter = newBatchWriter(HTTPConfiguration{
+		URL:          endpoint,
+		Headers:      config.Headers,
+		BatchSize:    config.BatchSize,
+		FlushFreq:    config.FlushFreq,
+		QueueSize:    config.QueueSize,
+		Timeout:      config.Timeout,
+		RetryMax:     config.RetryMax,
+		RetryFreq:    config.RetryFreq,
+		TLSCfg:       config.TLSCfg,
+		ErrorHandler: config.ErrorHandler,
+	}, otlpContentType, ow.encode)
+	ow.check = otlpCheck
+	if ow.conn != nil {
+		ow.send = ow.export
+	}
+	return ow, nil
+}
+
+// otlpResource returns the encoded resource with the configured attributes
+func otlpResource(config OTLPConfiguration, service string) ([]byte, error) {
+	attributes := map[string]string{OTLPServiceNameKey: service}
+	if config.ServiceVersion != "" {
+		attributes[OTLPServiceVersionKey] = config.ServiceVersion
+	}
+	attributes[OTLPHostNameKey] = config.HostName
+	if config.HostName == "" {
+		attributes[OTLPHostNameKey], _ = os.Hostname()
+	}
+	for key, value := range config.Resource {
+		attributes[key] = value
+	}
+
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	resource := &resourcepb.Resource{}
+	for _, key := range keys {
+		resource.Attributes = append(resource.Attributes,
+			&commonpb.KeyValue{Key: key, Value: otlpValue(attributes[key])})
+	}
+
+	return proto.Marshal(resource)
+}
+
+// write adds a log record with the level, message and fields to the batch
+// trace correlation fields become the trace context of the log record
+func (ow *otlpWriter) write(level LevelType, t time.Time, msg string,
+	fields map[string]interface{}) error {
+
+	record := &logspb.LogRecord{
+		TimeUnixNano:         uint64(t.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       getOTLPSeverity(level),
+		SeverityText:         string(level),
+		Body:                 otlpValue(msg),
+	}
+
+	var tc traceContext
+	keys := make([]string, 0, len(fields))
+	for key, value := range fields {
+		if s, ok := value.(string); ok && tc.set(key, s) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		record.Attributes = append(record.Attributes,
+			&commonpb.KeyValue{Key: key, Value: otlpValue(fields[key])})
+	}
+	if tc.traceParent() != "" {
+		record.TraceId, _ = hex.DecodeString(tc.traceID)
+		record.SpanId, _ = hex.DecodeString(tc.spanID)
+		flags, _ := strconv.ParseUint(tc.flags, 16, 8)
+		record.Flags = uint32(flags)
+	}
+
+	data, err := proto.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return ow.add(httpRecord{line: data, time: t})
+}
+
+// otlpValue returns the any value of a field
+// values other than these types are sent as JSON strings
+func otlpValue(value interface{}) *commonpb.AnyValue {
+	switch v := value.(type) {
+	case string:
+		return &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+		i, _ := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+		return &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_IntValue{IntValue: i}}
+	case float32:
+		return &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		return &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v}}
+	case []byte:
+		return &commonpb.AnyValue{
+			Value: &commonpb.AnyValue_BytesValue{BytesValue: v}}
+	case error:
+		return otlpValue(v.Error())
+	case time.Time:
+		return otlpValue(v.Format(time.RFC3339Nano))
+	case fmt.Stringer:
+		return otlpValue(v.String())
+	case []interface{}:
+		values := make([]*commonpb.AnyValue, len(v))
+		for i, item := range v {
+			values[i] = otlpValue(item)
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{
+			ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]*commonpb.KeyValue, len(keys))
+		for i, key := range keys {
+			values[i] = &commonpb.KeyValue{Key: key, Value: otlpValue(v[key])}
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{
+			KvlistValue: &commonpb.KeyValueList{Values: values}}}
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return otlpValue(fmt.Sprint(v))
+		}
+		return otlpValue(string(data))
+	}
+}
+
+// encode returns the export request for a batch of encoded log records
+// ExportLogsServiceRequest{resource_logs=1},
+// ResourceLogs{resource=1, scope_logs=2}, ScopeLogs{scope=1, log_records=2}
+func (ow *otlpWriter) encode(batch []httpRecord) ([]httpBody, error) {
+	var scopeLogs []byte
+	scopeLogs = protowire.AppendTag(scopeLogs, 1, protowire.BytesType)
+	scopeLogs = protowire.AppendBytes(scopeLogs, ow.scope)
+	for _, record := range batch {
+		scopeLogs = protowire.AppendTag(scopeLogs, 2, protowire.BytesType)
+		scopeLogs = protowire.AppendBytes(scopeLogs, record.line)
+	}
+
+	var resourceLogs []byte
+	resourceLogs = protowire.AppendTag(resourceLogs, 1, protowire.BytesType)
+	resourceLogs = protowire.AppendBytes(resourceLogs, ow.resource)
+	resourceLogs = protowire.AppendTag(resourceLogs, 2, protowire.BytesType)
+	resourceLogs = protowire.AppendBytes(resourceLogs, scopeLogs)
+
+	var request []byte
+	request = protowire.AppendTag(request, 1, protowire.BytesType)
+	request = protowire.AppendBytes(request, resourceLogs)
+	return []httpBody{{request, len(batch)}}, nil
+}
+
+// export sends the request body once using grpc
+func (ow *otlpWriter) export(body []byte) ([]byte, bool, time.Duration,
+	error) {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		ow.config.Timeout)
+	defer cancel()
+	if len(ow.config.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx,
+			metadata.New(ow.config.Headers))
+	}
+
+	var reply []byte
+	err := ow.conn.Invoke(ctx, otlpExportMethod, &body, &reply,
+		grpc.ForceCodec(otlpRawCodec{}))
+	if err != nil {
+		// retryable codes of the otlp specification
+		switch status.Code(err) {
+		case codes.Canceled, codes.DeadlineExceeded, codes.Aborted,
+			codes.OutOfRange, codes.Unavailable, codes.DataLoss,
+			codes.ResourceExhausted:
+			return nil, true, 0, fmt.Errorf("OTLP export: %w", err)
+		}
+		return nil, false, 0, fmt.Errorf("OTLP export: %w", err)
+	}
+	return reply, false, 0, nil
+}
+
+// otlpCheck returns the number of log records the collector rejected
+func otlpCheck(reply []byte) (int, error) {
+	var response collogspb.ExportLogsServiceResponse
+	if err := proto.Unmarshal(reply, &response); err != nil {
+		return 0, fmt.Errorf("OTLP export response: %w", err)
+	}
+	partial := response.GetPartialSuccess()
+	if partial.GetRejectedLogRecords() == 0 {
+		return 0, nil
+	}
+	return int(partial.GetRejectedLogRecords()),
+		fmt.Errorf("OTLP export rejected %d log records: %s",
+			partial.GetRejectedLogRecords(),
+			strings.TrimSpace(partial.GetErrorMessage()))
+}
+
+// closeContext exports the remaining records until ctx done
+// and closes the grpc connection
+func (ow *otlpWriter) closeContext(ctx context.Context) error {
+	err := ow.httpWriter.closeContext(ctx)
+	if ow.conn != nil {
+		ow.conn.Close()
+	}
+	return err
+}
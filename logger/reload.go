@@ -0,0 +1,445 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// reloadType provides configuration reload mode type
+type reloadType string
+
+// Supported configuration reload modes
+const (
+	ReloadNone   reloadType = "none"   // default
+	ReloadWatch  reloadType = "watch"  // reload when the config file changes
+	ReloadSignal reloadType = "signal" // reload on SIGHUP
+	ReloadBoth   reloadType = "both"
+)
+
+// reloadCloseTimeout bounds how long replaced loggers drain their sinks
+const reloadCloseTimeout = 30 * time.Second
+
+// reloader swaps the implementation of reloadable loggers on config changes
+type reloader struct {
+	mut         sync.Mutex
+	roots       map[*reloadRoot]struct{}
+	cfgType     configType
+	cfgFile     string
+	initOnce    sync.Once
+	watchOnce   sync.Once
+	signalOnce  sync.Once
+	lastChanged LoggerConfiguration
+}
+
+// globalReloader serves all loggers created with a reload mode
+var globalReloader reloader
+
+// reloadGeneration is a swapped logger implementation
+type reloadGeneration struct {
+	gen    uint64
+	logger Logger
+}
+
+// reloadRoot holds the current implementation of a reloadable logger
+type reloadRoot struct {
+	current atomic.Value // *reloadGeneration
+	config  LoggerConfiguration
+}
+
+// reloadLogger is a Logger whose implementation is replaced on reload
+// derived loggers re-apply their derivation to each new implementation
+type reloadLogger struct {
+	root   *reloadRoot
+	parent *reloadLogger
+	derive func(Logger) Logger
+	cache  atomic.Value // *reloadGeneration
+}
+
+// newReloadLogger returns a logger that follows config file changes
+// on reload the logger takes the settings of the config file, apart from
+// those keepSettings keeps, whatever config it was created with
+func newReloadLogger(config LoggerConfiguration) (Logger, error) {
+	log, err := newPackageLogger(config)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &reloadRoot{config: config}
+	root.current.Store(&reloadGeneration{logger: log})
+
+	globalReloader.register(root)
+	globalReloader.start(config.ReloadMode)
+
+	return &reloadLogger{root: root}, nil
+}
+
+// keepSettings returns config with the settings of current that cannot
+// come from a config file
+func keepSettings(config, current LoggerConfiguration) LoggerConfiguration {
+	config.ReloadMode = current.ReloadMode
+	config.KafkaProducerCfg.TLSCfg = current.KafkaProducerCfg.TLSCfg
+	config.KafkaProducerCfg.ErrorHandler =
+		current.KafkaProducerCfg.ErrorHandler
+	config.SyslogCfg.TLSCfg = current.SyslogCfg.TLSCfg
+	config.HTTPCfg.TLSCfg = current.HTTPCfg.TLSCfg
+	config.HTTPCfg.ErrorHandler = current.HTTPCfg.ErrorHandler
+	config.LokiCfg.TLSCfg = current.LokiCfg.TLSCfg
+	config.LokiCfg.ErrorHandler = current.LokiCfg.ErrorHandler
+	config.ElasticCfg.TLSCfg = current.ElasticCfg.TLSCfg
+	config.ElasticCfg.ErrorHandler = current.ElasticCfg.ErrorHandler
+	config.OTLPCfg.TLSCfg = current.OTLPCfg.TLSCfg
+	config.OTLPCfg.ErrorHandler = current.OTLPCfg.ErrorHandler
+	return config
+}
+
+// register adds a logger to be swapped on reload
+func (r *reloader) register(root *reloadRoot) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if r.roots == nil {
+		r.roots = make(map[*reloadRoot]struct{})
+	}
+	r.roots[root] = struct{}{}
+}
+
+// unregister removes a closed logger
+func (r *reloader) unregister(root *reloadRoot) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	delete(r.roots, root)
+}
+
+// init finds the config file the same way as for auto init
+func (r *reloader) init() {
+	r.initOnce.Do(func() {
+		// environment overrides stay in effect unless only a file is used
+		r.cfgType = BothConfig
+		if configType(os.Getenv(ConfigTypeEnvName)) == FileConfig {
+			r.cfgType = FileConfig
+		}
+		r.cfgFile = os.Getenv(ConfigFileEnvName)
+		if r.cfgFile == "" {
+			r.cfgFile = ConfigFileName
+		}
+	})
+}
+
+// start begins watching the config file and/or catching SIGHUP
+func (r *reloader) start(mode reloadType) {
+	r.init()
+	if mode == ReloadWatch || mode == ReloadBoth {
+		r.watchOnce.Do(r.watchConfig)
+	}
+	if mode == ReloadSignal || mode == ReloadBoth {
+		r.signalOnce.Do(func() {
+			go r.signalCatcher()
+		})
+	}
+}
+
+// watchConfig reloads whenever viper reports the config file changed
+func (r *reloader) watchConfig() {
+	v := viper.New()
+	addConfigPaths(v, r.cfgFile)
+	if err := v.ReadInConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", errReload, err.Error())
+		return
+	}
+	v.OnConfigChange(func(event fsnotify.Event) {
+		r.reportReload()
+	})
+	v.WatchConfig()
+}
+
+// signalCatcher reloads on each SIGHUP
+func (r *reloader) signalCatcher() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		r.reportReload()
+	}
+}
+
+// reportReload reloads and prints any error since there is no caller
+func (r *reloader) reportReload() {
+	if err := r.reload(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+	}
+}
+
+// reload reads the config file and swaps every registered logger to it
+// loggers keep their current config if the new one is invalid or if any
+// sink fails to open, replaced loggers are closed in the background
+// new loggers share the log files and kafka spools of the loggers they
+// replace, as both are open until the replaced loggers are closed, so a
+// file is never appended or rotated, and a spool never replayed or pruned,
+// by two sinks at once
+func (r *reloader) reload() error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if len(r.roots) == 0 {
+		return nil
+	}
+
+	config, err := GetLoggerConfiguration(r.cfgType, r.cfgFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errReload, err)
+	}
+	if reflect.DeepEqual(config, r.lastChanged) {
+		// file watchers report several events for each change
+		return nil
+	}
+
+	built := make(map[*reloadRoot]Logger)
+	configs := make(map[*reloadRoot]LoggerConfiguration)
+	for root := range r.roots {
+		newConfig := keepSettings(config, root.config)
+		err = checkConfig(newConfig)
+		if err == nil {
+			built[root], err = newPackageLogger(newConfig)
+		}
+		if err != nil {
+			// roll back by discarding any loggers already built
+			ctx, cancel := context.WithTimeout(context.Background(),
+				reloadCloseTimeout)
+			defer cancel()
+			for _, log := range built {
+				log.Close(ctx)
+			}
+			return fmt.Errorf("%s: %w", errReload, err)
+		}
+		configs[root] = newConfig
+	}
+
+	for root, log := range built {
+		old := root.swap(log)
+		root.config = configs[root]
+		go closeReplaced(old)
+	}
+	r.lastChanged = config
+	return nil
+}
+
+// closeReplaced drains and closes a logger that has been swapped out
+func closeReplaced(log Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), reloadCloseTimeout)
+	defer cancel()
+	if err := log.Close(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to close replaced logger: %s\n",
+			err.Error())
+	}
+}
+
+// swap replaces the implementation and returns the previous one
+func (root *reloadRoot) swap(log Logger) Logger {
+	old := root.current.Load().(*reloadGeneration)
+	root.current.Store(&reloadGeneration{gen: old.gen + 1, logger: log})
+	return old.logger
+}
+
+// get returns the current implementation, deriving it again after a reload
+func (l *reloadLogger) get() Logger {
+	current := l.root.current.Load().(*reloadGeneration)
+	if l.parent == nil {
+		return current.logger
+	}
+	if cached, ok := l.cache.Load().(*reloadGeneration); ok &&
+		cached.gen == current.gen {
+		return cached.logger
+	}
+	log := l.derive(l.parent.get())
+	l.cache.Store(&reloadGeneration{gen: current.gen, logger: log})
+	return log
+}
+
+// with returns a logger derived from this one that survives reloads
+func (l *reloadLogger) with(derive func(Logger) Logger) Logger {
+	return &reloadLogger{
+		root:   l.root,
+		parent: l,
+		derive: derive,
+	}
+}
+
+// The following methods meet the contract for the logger interface
+
+func (l *reloadLogger) Print(args ...interface{}) {
+	l.get().Print(args...)
+}
+
+func (l *reloadLogger) Printf(format string, args ...interface{}) {
+	l.get().Printf(format, args...)
+}
+
+func (l *reloadLogger) Println(args ...interface{}) {
+	l.get().Println(args...)
+}
+
+func (l *reloadLogger) Debug(args ...interface{}) {
+	l.get().Debug(args...)
+}
+
+func (l *reloadLogger) Debugf(format string, args ...interface{}) {
+	l.get().Debugf(format, args...)
+}
+
+func (l *reloadLogger) Debugln(args ...interface{}) {
+	l.get().Debugln(args...)
+}
+
+func (l *reloadLogger) Info(args ...interface{}) {
+	l.get().Info(args...)
+}
+
+func (l *reloadLogger) Infof(format string, args ...interface{}) {
+	l.get().Infof(format, args...)
+}
+
+func (l *reloadLogger) Infoln(args ...interface{}) {
+	l.get().Infoln(args...)
+}
+
+func (l *reloadLogger) Warn(args ...interface{}) {
+	l.get().Warn(args...)
+}
+
+func (l *reloadLogger) Warnf(format string, args ...interface{}) {
+	l.get().Warnf(format, args...)
+}
+
+func (l *reloadLogger) Warnln(args ...interface{}) {
+	l.get().Warnln(args...)
+}
+
+func (l *reloadLogger) Error(args ...interface{}) {
+	l.get().Error(args...)
+}
+
+func (l *reloadLogger) Errorf(format string, args ...interface{}) {
+	l.get().Errorf(format, args...)
+}
+
+func (l *reloadLogger) Errorln(args ...interface{}) {
+	l.get().Errorln(args...)
+}
+
+func (l *reloadLogger) Fatal(args ...interface{}) {
+	l.get().Fatal(args...)
+}
+
+func (l *reloadLogger) Fatalf(format string, args ...interface{}) {
+	l.get().Fatalf(format, args...)
+}
+
+func (l *reloadLogger) Fatalln(args ...interface{}) {
+	l.get().Fatalln(args...)
+}
+
+func (l *reloadLogger) Panic(args ...interface{}) {
+	l.get().Panic(args...)
+}
+
+func (l *reloadLogger) Panicf(format string, args ...interface{}) {
+	l.get().Panicf(format, args...)
+}
+
+func (l *reloadLogger) Panicln(args ...interface{}) {
+	l.get().Panicln(args...)
+}
+
+func (l *reloadLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.get().Debugw(msg, keysAndValues...)
+}
+
+func (l *reloadLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.get().Infow(msg, keysAndValues...)
+}
+
+func (l *reloadLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.get().Warnw(msg, keysAndValues...)
+}
+
+func (l *reloadLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.get().Errorw(msg, keysAndValues...)
+}
+
+func (l *reloadLogger) Fatalw(msg string, keysAndValues ...interface{}) {
+	l.get().Fatalw(msg, keysAndValues...)
+}
+
+func (l *reloadLogger) Panicw(msg string, keysAndValues ...interface{}) {
+	l.get().Panicw(msg, keysAndValues...)
+}
+
+// WithFields adds fixed fields to each log record, kept across reloads
+func (l *reloadLogger) WithFields(fields LogFields) Logger {
+	return l.with(func(log Logger) Logger {
+		return log.WithFields(fields)
+	})
+}
+
+// WithContext adds the fields extracted from ctx, kept across reloads
+func (l *reloadLogger) WithContext(ctx context.Context) Logger {
+	return l.with(func(log Logger) Logger {
+		return log.WithContext(ctx)
+	})
+}
+
+// WithKafkaFilterFn adds a filter function, kept across reloads
+func (l *reloadLogger) WithKafkaFilterFn(filterFn FilterFunc) Logger {
+	return l.with(func(log Logger) Logger {
+		return log.WithKafkaFilterFn(filterFn)
+	})
+}
+
+// WithKafkaKeyFn adds a key function, kept across reloads
+func (l *reloadLogger) WithKafkaKeyFn(keyFn KeyFunc) Logger {
+	return l.with(func(log Logger) Logger {
+		return log.WithKafkaKeyFn(keyFn)
+	})
+}
+
+// SetLevel changes the log level until the next reload
+func (l *reloadLogger) SetLevel(level LevelType) {
+	l.get().SetLevel(level)
+}
+
+// GetLevel returns the current log level
+func (l *reloadLogger) GetLevel() LevelType {
+	return l.get().GetLevel()
+}
+
+// KafkaStats returns the counters of the current kafka producer
+func (l *reloadLogger) KafkaStats() ProducerStats {
+	return l.get().KafkaStats()
+}
+
+// Sync flushes the sinks of the current implementation
+func (l *reloadLogger) Sync() error {
+	return l.get().Sync()
+}
+
+// Close stops reloading and closes the current implementation
+func (l *reloadLogger) Close(ctx context.Context) error {
+	globalReloader.unregister(l.root)
+	return l.get().Close(ctx)
+}
+
+// Reload reads the config file and applies it to all loggers created with
+// a reload mode, the loggers are unchanged if the new config is invalid
+func Reload() error {
+	return globalReloader.reload()
+}
@@ -0,0 +1,810 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Slog levels of the panic and fatal log levels, ordered as zap orders them
+const (
+	slogLevelPanic = slog.LevelError + 4
+	slogLevelFatal = slog.LevelError + 8
+)
+
+// getSlogLevel converts log level to slog level
+func getSlogLevel(level LevelType) slog.Level {
+	switch level {
+	case DebugType:
+		return slog.LevelDebug
+	case WarnType:
+		return slog.LevelWarn
+	case ErrorType:
+		return slog.LevelError
+	case FatalType:
+		return slogLevelFatal
+	case PanicType:
+		return slogLevelPanic
+	case InfoType:
+		fallthrough
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// getSlogLevelType converts slog level to log level
+// levels between the slog levels belong to the level below them
+func getSlogLevelType(level slog.Level) LevelType {
+	switch {
+	case level < slog.LevelInfo:
+		return DebugType
+	case level < slog.LevelWarn:
+		return InfoType
+	case level < slog.LevelError:
+		return WarnType
+	case level < slogLevelPanic:
+		return ErrorType
+	case level < slogLevelFatal:
+		return PanicType
+	default:
+		return FatalType
+	}
+}
+
+// getSlogSinkLevel returns the level of a sink
+// a sink without a level of its own follows the log level
+func getSlogSinkLevel(sinkLevel LevelType, level *slog.LevelVar) slog.Leveler {
+	if sinkLevel == "" {
+		return level
+	}
+	return getSlogLevel(sinkLevel)
+}
+
+// slogReplacer returns the function replacing the time, level and message
+// of each record so records have the keys and values of the zap encoders
+func slogReplacer(format FormatType,
+	config LoggerConfiguration) func([]string, slog.Attr) slog.Attr {
+
+	ceKeys := format == CEFormat && config.EnableCloudEvents
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) > 0 {
+			return a
+		}
+		switch value := a.Value.Any().(type) {
+		case time.Time:
+			if a.Key != slog.TimeKey {
+				break
+			}
+			if !config.EnableTimeStamps {
+				return slog.Attr{}
+			}
+			return slog.String(CETimeKey, value.Format(time.RFC3339))
+		case slog.Level:
+			if a.Key != slog.LevelKey {
+				break
+			}
+			level := string(getSlogLevelType(value))
+			if ceKeys && config.CloudEventsCfg.SetSubjectLevel {
+				return slog.String(CESubjectKey, level)
+			}
+			return slog.String(slog.LevelKey, level)
+		case string:
+			if a.Key == slog.MessageKey && ceKeys {
+				return slog.String(CEDataKey, value)
+			}
+		}
+		return a
+	}
+}
+
+// slogAttrs returns the fields as attributes sorted by key
+func slogAttrs(fields LogFields) []slog.Attr {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attrs := make([]slog.Attr, len(keys))
+	for i, key := range keys {
+		attrs[i] = slog.Any(key, fields[key])
+	}
+	return attrs
+}
+
+// getSlogHandler returns a slog handler writing records in format to w
+func getSlogHandler(format FormatType, w io.Writer, config LoggerConfiguration,
+	fields LogFields, level slog.Leveler) slog.Handler {
+
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: slogReplacer(format, config),
+	}
+	switch format {
+	case JSONFormat:
+		return slog.NewJSONHandler(w, opts)
+	case CEFormat:
+		// CE fields are added like WithFields at handler level
+		return slog.NewJSONHandler(w, opts).WithAttrs(slogAttrs(fields))
+	case TextFormat:
+		fallthrough
+	default:
+		return slog.NewTextHandler(w, opts)
+	}
+}
+
+// slogHandler provides a slog handler that passes records to the handler
+// of each sink and gives records of sinks with cloudevents format one id
+type slogHandler struct {
+	handlers    []slog.Handler
+	ceFormat    []bool
+	cloudEvents *CloudEvents // nil if records do not need shared ids
+	trace       traceContext // trace correlation fields added by WithAttrs
+}
+
+// Enabled meets the interface for the slog handler
+func (h *slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle meets the interface for the slog handler
+// the id is only generated if a handler with cloudevents format is enabled
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	var ceRecord *slog.Record
+
+	for i, handler := range h.handlers {
+		if !handler.Enabled(ctx, r.Level) {
+			continue
+		}
+		record := r
+		if h.ceFormat[i] {
+			if ceRecord == nil {
+				rec, err := h.ceRecord(r)
+				if err != nil {
+					return err
+				}
+				ceRecord = &rec
+			}
+			record = *ceRecord
+		}
+		if err := handler.Handle(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ceRecord returns a copy of r with the cloudevents id and trace attributes
+func (h *slogHandler) ceRecord(r slog.Record) (slog.Record, error) {
+	record := r.Clone()
+	if h.cloudEvents != nil {
+		id, err := h.cloudEvents.ceRecordID(r.Message)
+		if err != nil {
+			return record, err
+		}
+		if id != "" {
+			record.AddAttrs(slog.String(CEIDKey, id))
+		}
+	}
+
+	tc := h.trace
+	r.Attrs(func(a slog.Attr) bool {
+		tc.set(a.Key, a.Value.String())
+		return true
+	})
+	if parent := tc.traceParent(); parent != "" {
+		record.AddAttrs(slog.String(CETraceParentKey, parent))
+		if tc.state != "" {
+			record.AddAttrs(slog.String(CETraceStateKey, tc.state))
+		}
+	}
+	return record, nil
+}
+
+// WithAttrs meets the interface for the slog handler
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	trace := h.trace
+	for _, a := range attrs {
+		trace.set(a.Key, a.Value.String())
+	}
+	return &slogHandler{handlers, h.ceFormat, h.cloudEvents, trace}
+}
+
+// WithGroup meets the interface for the slog handler
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return &slogHandler{handlers, h.ceFormat, h.cloudEvents, h.trace}
+}
+
+// slogKafkaWriter passes the kafka functions of the record being handled
+// to the kafka writer, the lock is held while the record is handled
+type slogKafkaWriter struct {
+	mu     sync.Mutex
+	writer *ZapKafkaWriter
+	funcs  *kafkaFuncs
+}
+
+// Write meets the interface for the io writer
+func (w *slogKafkaWriter) Write(msg []byte) (int, error) {
+	return w.writer.writeFuncs(msg, w.funcs)
+}
+
+// slogKafkaHandler provides a slog handler for the kafka sink that takes
+// the kafka functions of each record from its context
+// used for text format, other formats use the kafka fields handler
+type slogKafkaHandler struct {
+	slog.Handler
+	writer *slogKafkaWriter
+}
+
+// Handle meets the interface for the slog handler
+func (h *slogKafkaHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.writer.mu.Lock()
+	defer h.writer.mu.Unlock()
+	h.writer.funcs = getKafkaFuncs(ctx)
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs meets the interface for the slog handler
+func (h *slogKafkaHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &slogKafkaHandler{h.Handler.WithAttrs(attrs), h.writer}
+}
+
+// WithGroup meets the interface for the slog handler
+func (h *slogKafkaHandler) WithGroup(name string) slog.Handler {
+	return &slogKafkaHandler{h.Handler.WithGroup(name), h.writer}
+}
+
+// slogKafkaFieldsHandler provides a slog handler for the kafka sink that
+// passes the fields of each record to the kafka writer with the kafka
+// functions from its context, fields have the values the slog json
+// handler would write and groups are nested maps
+type slogKafkaFieldsHandler struct {
+	level   slog.Leveler
+	layout  *kafkaLayout
+	writer  *ZapKafkaWriter
+	replace func([]string, slog.Attr) slog.Attr
+	fields  map[string]interface{} // added by WithAttrs
+	groups  []string               // opened by WithGroup
+}
+
+// replaceAttrs replaces the attributes in place as the slog json handler
+// replaces them, only attributes outside of groups are replaced
+func (h *slogKafkaFieldsHandler) replaceAttrs(attrs []slog.Attr) []slog.Attr {
+	if len(h.groups) > 0 {
+		return attrs
+	}
+	for i, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Value.Kind() != slog.KindGroup {
+			attrs[i] = h.replace(nil, a)
+		} else {
+			attrs[i] = a
+		}
+	}
+	return attrs
+}
+
+// addSlogAttrs returns a copy of fields with attrs added in the groups
+// only the maps of the groups are copied, other values are shared
+func addSlogAttrs(fields map[string]interface{}, groups []string,
+	attrs []slog.Attr) map[string]interface{} {
+
+	msgMap := make(map[string]interface{}, len(fields)+len(attrs))
+	for key, value := range fields {
+		msgMap[key] = value
+	}
+	if len(groups) > 0 {
+		group, _ := msgMap[groups[0]].(map[string]interface{})
+		msgMap[groups[0]] = addSlogAttrs(group, groups[1:], attrs)
+		return msgMap
+	}
+	for _, a := range attrs {
+		addSlogAttr(msgMap, a)
+	}
+	return msgMap
+}
+
+// addSlogAttr adds an attribute to fields as the slog json handler writes
+// it, empty attributes and groups are ignored and groups without keys inlined
+func addSlogAttr(fields map[string]interface{}, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return
+		}
+		if a.Key == "" {
+			for _, attr := range attrs {
+				addSlogAttr(fields, attr)
+			}
+			return
+		}
+		group, _ := fields[a.Key].(map[string]interface{})
+		fields[a.Key] = addSlogAttrs(group, nil, attrs)
+	case slog.KindTime:
+		fields[a.Key] = a.Value.Time().Format(time.RFC3339Nano)
+	case slog.KindDuration:
+		fields[a.Key] = int64(a.Value.Duration())
+	default:
+		value := a.Value.Any()
+		if err, ok := value.(error); ok {
+			if _, ok := value.(json.Marshaler); !ok {
+				value = err.Error()
+			}
+		}
+		fields[a.Key] = value
+	}
+}
+
+// Enabled meets the interface for the slog handler
+func (h *slogKafkaFieldsHandler) Enabled(ctx context.Context,
+	level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle meets the interface for the slog handler
+func (h *slogKafkaFieldsHandler) Handle(ctx context.Context,
+	r slog.Record) error {
+
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	msgMap := addSlogAttrs(h.fields, h.groups, h.replaceAttrs(attrs))
+	h.layout.record(string(getSlogLevelType(r.Level)), r.Time, r.Message,
+		msgMap)
+	return h.writer.writeFields(msgMap, getKafkaFuncs(ctx))
+}
+
+// WithAttrs meets the interface for the slog handler
+func (h *slogKafkaFieldsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	clone := *h
+	// the attributes belong to the caller
+	attrs = append([]slog.Attr(nil), attrs...)
+	clone.fields = addSlogAttrs(h.fields, h.groups, h.replaceAttrs(attrs))
+	return &clone
+}
+
+// WithGroup meets the interface for the slog handler
+func (h *slogKafkaFieldsHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &clone
+}
+
+// slogLogger provides a Logger backed by slog handlers
+type slogLogger struct {
+	logger      *slog.Logger
+	kafkaWriter *ZapKafkaWriter
+	sinks       *logSinks
+	level       *slog.LevelVar
+	kafkaFuncs  *kafkaFuncs
+}
+
+// newSlogLogger returns a slog logger instance
+// only the console, file and kafka sinks are supported
+func newSlogLogger(config LoggerConfiguration) (Logger, error) {
+	var kafkaWriter *ZapKafkaWriter
+	var cloudEvents *CloudEvents
+	var fields LogFields
+	var fwriter io.Writer
+	var err error
+	level := new(slog.LevelVar)
+	level.Set(getSlogLevel(config.LogLevel))
+	handler := &slogHandler{}
+	sinks := &logSinks{}
+
+	if config.EnableCloudEvents {
+		cloudEvents = newCloudEvents(config.CloudEventsCfg)
+		fields = cloudEvents.fields
+	}
+
+	if config.EnableKafka {
+		kafkaWriter, err = newZapKafkaWriter(config.KafkaProducerCfg,
+			cloudEvents, config.CloudEventsCfg)
+		if err != nil {
+			return nil, sinks.abort(err)
+		}
+		sinks.add(kafkaWriter)
+		kafkaLevel := getSlogSinkLevel(config.KafkaLevel, level)
+		if layout := newKafkaLayout(config, cloudEvents); layout != nil {
+			kafkaWriter.kp.setLayout(layout)
+			handler.handlers = append(handler.handlers,
+				&slogKafkaFieldsHandler{
+					level:   kafkaLevel,
+					layout:  layout,
+					writer:  kafkaWriter,
+					replace: slogReplacer(config.KafkaFormat, config),
+				})
+		} else {
+			kwriter := &slogKafkaWriter{writer: kafkaWriter}
+			handler.handlers = append(handler.handlers, &slogKafkaHandler{
+				getSlogHandler(config.KafkaFormat, kwriter, config, fields,
+					kafkaLevel),
+				kwriter,
+			})
+		}
+		handler.ceFormat = append(handler.ceFormat,
+			ceIDFormat(config, config.KafkaFormat))
+	}
+
+	if config.EnableConsole {
+		cwriter := getConsoleWriter(config)
+		handler.handlers = append(handler.handlers,
+			getSlogHandler(config.ConsoleFormat, cwriter, config, fields,
+				getSlogSinkLevel(config.ConsoleLevel, level)))
+		handler.ceFormat = append(handler.ceFormat,
+			ceIDFormat(config, config.ConsoleFormat))
+	}
+
+	if config.EnableFile {
+		fwriter, err = getFileWriter(config)
+		if err != nil {
+			return nil, sinks.abort(err)
+		}
+		sinks.add(fileSink{fwriter})
+		handler.handlers = append(handler.handlers,
+			getSlogHandler(config.FileFormat, fwriter, config, fields,
+				getSlogSinkLevel(config.FileLevel, level)))
+		handler.ceFormat = append(handler.ceFormat,
+			ceIDFormat(config, config.FileFormat))
+	}
+
+	if kafkaWriter != nil {
+		kafkaWriter.kp.setFallback(getFallbackWriter(config, fwriter))
+	}
+
+	if ceSharedIDs(config) {
+		handler.cloudEvents = cloudEvents
+	}
+
+	return &slogLogger{
+		logger:      slog.New(handler),
+		kafkaWriter: kafkaWriter,
+		sinks:       sinks,
+		level:       level,
+	}, nil
+}
+
+// enabled returns true if a record at level is logged
+// fatal and panic records are always handled so they exit or panic
+func (l *slogLogger) enabled(level slog.Level) bool {
+	return level >= slogLevelPanic ||
+		l.logger.Enabled(context.Background(), level)
+}
+
+// write logs a record, exits after fatal records and panics after panic
+func (l *slogLogger) write(level slog.Level, msg string,
+	keysAndValues ...interface{}) {
+	ctx := context.Background()
+	if l.kafkaFuncs != nil {
+		ctx = withKafkaFuncs(ctx, l.kafkaFuncs)
+	}
+	l.logger.Log(ctx, level, msg, keysAndValues...)
+	switch level {
+	case slogLevelFatal:
+		l.Sync()
+		os.Exit(1)
+	case slogLevelPanic:
+		panic(msg)
+	}
+}
+
+// print logs the args formatted like fmt.Sprint
+func (l *slogLogger) print(level slog.Level, args ...interface{}) {
+	if l.enabled(level) {
+		l.write(level, fmt.Sprint(args...))
+	}
+}
+
+// printf logs the args formatted like fmt.Sprintf
+func (l *slogLogger) printf(level slog.Level, format string,
+	args ...interface{}) {
+	if l.enabled(level) {
+		l.write(level, fmt.Sprintf(format, args...))
+	}
+}
+
+// println logs the args formatted like fmt.Sprintln without the newline
+func (l *slogLogger) println(level slog.Level, args ...interface{}) {
+	if l.enabled(level) {
+		l.write(level, strings.TrimRight(fmt.Sprintln(args...), "\n"))
+	}
+}
+
+// printw logs the message with the key value pairs
+func (l *slogLogger) printw(level slog.Level, msg string,
+	keysAndValues ...interface{}) {
+	if l.enabled(level) {
+		l.write(level, msg, keysAndValues...)
+	}
+}
+
+// The following methods meet the contract for the logger interface
+
+func (l *slogLogger) Print(args ...interface{}) {
+	l.print(slog.LevelInfo, args...)
+}
+
+func (l *slogLogger) Printf(format string, args ...interface{}) {
+	l.printf(slog.LevelInfo, format, args...)
+}
+
+func (l *slogLogger) Println(args ...interface{}) {
+	l.println(slog.LevelInfo, args...)
+}
+
+func (l *slogLogger) Debug(args ...interface{}) {
+	l.print(slog.LevelDebug, args...)
+}
+
+func (l *slogLogger) Debugf(format string, args ...interface{}) {
+	l.printf(slog.LevelDebug, format, args...)
+}
+
+func (l *slogLogger) Debugln(args ...interface{}) {
+	l.println(slog.LevelDebug, args...)
+}
+
+func (l *slogLogger) Info(args ...interface{}) {
+	l.print(slog.LevelInfo, args...)
+}
+
+func (l *slogLogger) Infof(format string, args ...interface{}) {
+	l.printf(slog.LevelInfo, format, args...)
+}
+
+func (l *slogLogger) Infoln(args ...interface{}) {
+	l.println(slog.LevelInfo, args...)
+}
+
+func (l *slogLogger) Warn(args ...interface{}) {
+	l.print(slog.LevelWarn, args...)
+}
+
+func (l *slogLogger) Warnf(format string, args ...interface{}) {
+	l.printf(slog.LevelWarn, format, args...)
+}
+
+func (l *slogLogger) Warnln(args ...interface{}) {
+	l.println(slog.LevelWarn, args...)
+}
+
+func (l *slogLogger) Error(args ...interface{}) {
+	l.print(slog.LevelError, args...)
+}
+
+func (l *slogLogger) Errorf(format string, args ...interface{}) {
+	l.printf(slog.LevelError, format, args...)
+}
+
+func (l *slogLogger) Errorln(args ...interface{}) {
+	l.println(slog.LevelError, args...)
+}
+
+func (l *slogLogger) Fatal(args ...interface{}) {
+	l.print(slogLevelFatal, args...)
+}
+
+func (l *slogLogger) Fatalf(format string, args ...interface{}) {
+	l.printf(slogLevelFatal, format, args...)
+}
+
+func (l *slogLogger) Fatalln(args ...interface{}) {
+	l.println(slogLevelFatal, args...)
+}
+
+func (l *slogLogger) Panic(args ...interface{}) {
+	l.print(slogLevelPanic, args...)
+}
+
+func (l *slogLogger) Panicf(format string, args ...interface{}) {
+	l.printf(slogLevelPanic, format, args...)
+}
+
+func (l *slogLogger) Panicln(args ...interface{}) {
+	l.println(slogLevelPanic, args...)
+}
+
+func (l *slogLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.printw(slog.LevelDebug, msg, keysAndValues...)
+}
+
+func (l *slogLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.printw(slog.LevelInfo, msg, keysAndValues...)
+}
+
+func (l *slogLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.printw(slog.LevelWarn, msg, keysAndValues...)
+}
+
+func (l *slogLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.printw(slog.LevelError, msg, keysAndValues...)
+}
+
+func (l *slogLogger) Fatalw(msg string, keysAndValues ...interface{}) {
+	l.printw(slogLevelFatal, msg, keysAndValues...)
+}
+
+func (l *slogLogger) Panicw(msg string, keysAndValues ...interface{}) {
+	l.printw(slogLevelPanic, msg, keysAndValues...)
+}
+
+// WithFields adds fixed fields to each log record
+func (l *slogLogger) WithFields(fields LogFields) Logger {
+	args := make([]interface{}, 0, len(fields))
+	for _, attr := range slogAttrs(fields) {
+		args = append(args, attr)
+	}
+	return &slogLogger{l.logger.With(args...), l.kafkaWriter, l.sinks,
+		l.level, l.kafkaFuncs}
+}
+
+// WithContext adds the fields extracted from ctx to each log record
+func (l *slogLogger) WithContext(ctx context.Context) Logger {
+	return withContext(l, ctx)
+}
+
+// WithKafkaFilterFn returns a logger adding a filter function for each of
+// its kafka records, after those of this logger
+func (l *slogLogger) WithKafkaFilterFn(filterFn FilterFunc) Logger {
+	return &slogLogger{l.logger, l.kafkaWriter, l.sinks, l.level,
+		l.kafkaFuncs.withFilter(filterFn)}
+}
+
+// WithKafkaKeyFn returns a logger using a key function for its kafka records
+func (l *slogLogger) WithKafkaKeyFn(keyFn KeyFunc) Logger {
+	return &slogLogger{l.logger, l.kafkaWriter, l.sinks, l.level,
+		l.kafkaFuncs.withKey(keyFn)}
+}
+
+// SetLevel changes the log level of this and all related loggers
+// sinks configured with a level of their own are not affected
+func (l *slogLogger) SetLevel(level LevelType) {
+	l.level.Set(getSlogLevel(level))
+}
+
+// GetLevel returns the current log level
+func (l *slogLogger) GetLevel() LevelType {
+	return getSlogLevelType(l.level.Level())
+}
+
+// KafkaStats returns the kafka producer message counters
+func (l *slogLogger) KafkaStats() ProducerStats {
+	if l.kafkaWriter == nil {
+		return ProducerStats{}
+	}
+	return l.kafkaWriter.kp.Stats()
+}
+
+// Sync flushes the file and kafka sinks
+func (l *slogLogger) Sync() error {
+	return l.sinks.sync()
+}
+
+// Close flushes and releases all sinks, kafka is drained until ctx is done
+func (l *slogLogger) Close(ctx context.Context) error {
+	return l.sinks.close(ctx)
+}
+
+// loggerHandler provides a slog handler that logs records to a Logger
+type loggerHandler struct {
+	logger Logger
+	group  string // prefix of attribute keys, ends with . if set
+}
+
+// NewSlogHandler returns a slog handler that logs records to log
+// so packages using slog log to the sinks of log
+// attributes in groups become fields with keys prefixed by the group names
+// records above the error level are logged as errors, never fatal or panic
+func NewSlogHandler(log Logger) slog.Handler {
+	return &loggerHandler{logger: log}
+}
+
+// appendSlogAttr appends the key and value of an attribute, groups are
+// flattened into a key for each of their attributes
+func appendSlogAttr(keysAndValues []interface{}, prefix string,
+	a slog.Attr) []interface{} {
+
+	value := a.Value.Resolve()
+	if a.Key == "" && value.Kind() != slog.KindGroup {
+		return keysAndValues
+	}
+	if value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, attr := range value.Group() {
+			keysAndValues = appendSlogAttr(keysAndValues, prefix, attr)
+		}
+		return keysAndValues
+	}
+	return append(keysAndValues, prefix+a.Key, value.Any())
+}
+
+// Enabled meets the interface for the slog handler
+// sinks can have levels below the log level so the logger filters records
+func (h *loggerHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return true
+}
+
+// Handle meets the interface for the slog handler
+func (h *loggerHandler) Handle(ctx context.Context, r slog.Record) error {
+	keysAndValues := make([]interface{}, 0, 2*r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		keysAndValues = appendSlogAttr(keysAndValues, h.group, a)
+		return true
+	})
+
+	log := h.logger
+	if ctx != nil {
+		log = log.WithContext(ctx)
+	}
+	switch getSlogLevelType(r.Level) {
+	case DebugType:
+		log.Debugw(r.Message, keysAndValues...)
+	case InfoType:
+		log.Infow(r.Message, keysAndValues...)
+	case WarnType:
+		log.Warnw(r.Message, keysAndValues...)
+	default:
+		log.Errorw(r.Message, keysAndValues...)
+	}
+	return nil
+}
+
+// WithAttrs meets the interface for the slog handler
+func (h *loggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var keysAndValues []interface{}
+	for _, a := range attrs {
+		keysAndValues = appendSlogAttr(keysAndValues, h.group, a)
+	}
+	fields := LogFields{}
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fields[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+	return &loggerHandler{h.logger.WithFields(fields), h.group}
+}
+
+// WithGroup meets the interface for the slog handler
+func (h *loggerHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &loggerHandler{h.logger, h.group + name + "."}
+}
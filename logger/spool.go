@@ -0,0 +1,507 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// SpoolConfiguration provides kafka disk spool configuration type
+type SpoolConfiguration struct {
+	Directory  string
+	MaxBytes   int64         // spool is full beyond this size
+	MaxAge     time.Duration // older segments are discarded, 0 = no expiration
+	ReplayFreq time.Duration // how often the replayer checks the spool
+}
+
+// Spool segments are rotated once they exceed this size
+const spoolSegmentSize = 4 * 1024 * 1024
+
+// Spool segment file name extension
+const spoolExtension = ".spool"
+
+// spoolInputTimeout bounds how long a message waits for the producer
+// before it is written to the spool instead
+const spoolInputTimeout = time.Second
+
+// errSpoolFull is returned when a record would exceed the spool MaxBytes
+var errSpoolFull = errors.New("Kafka spool is full")
+
+// spoolRecord is a kafka message as written to a spool segment
+// the value is stored after cloudevents fields are added so IDs are preserved
+type spoolRecord struct {
+	Topic   string                `json:"topic"`
+	Key     []byte                `json:"key,omitempty"`
+	Value   []byte                `json:"value"`
+	Headers []sarama.RecordHeader `json:"headers,omitempty"`
+	Time    time.Time             `json:"time"`
+}
+
+// newSpoolRecord converts a producer message to a spool record
+func newSpoolRecord(pm *sarama.ProducerMessage) (*spoolRecord, error) {
+	var err error
+	rec := &spoolRecord{
+		Topic:   pm.Topic,
+		Headers: pm.Headers,
+		Time:    time.Now(),
+	}
+	if pm.Key != nil {
+		if rec.Key, err = pm.Key.Encode(); err != nil {
+			return nil, err
+		}
+	}
+	if pm.Value != nil {
+		if rec.Value, err = pm.Value.Encode(); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+// message converts a spool record back to a producer message
+func (rec *spoolRecord) message(metadata interface{}) *sarama.ProducerMessage {
+	pm := &sarama.ProducerMessage{
+		Topic:    rec.Topic,
+		Value:    sarama.ByteEncoder(rec.Value),
+		Headers:  rec.Headers,
+		Metadata: metadata,
+	}
+	if rec.Key != nil {
+		pm.Key = sarama.ByteEncoder(rec.Key)
+	}
+	return pm
+}
+
+// kafkaSpool is an on-disk write-ahead log of undelivered kafka messages
+// records are appended to segment files named by creation time
+type kafkaSpool struct {
+	config    SpoolConfiguration
+	mut       sync.Mutex
+	replayMut sync.Mutex // held by the producer replaying a segment
+	file      *os.File   // segment currently being appended
+	segSize   int64
+	size      int64 // total bytes in all segments
+	refs      int   // producers using the spool, guarded by spools
+}
+
+// spools holds the spools in use by directory, shared by their producers
+var spools = struct {
+	sync.Mutex
+	open map[string]*kafkaSpool
+}{open: make(map[string]*kafkaSpool)}
+
+// openKafkaSpool returns the spool of the configured directory, the spool
+// is created unless it is in use, in which case it takes the new config
+func openKafkaSpool(config SpoolConfiguration) (*kafkaSpool, error) {
+	if config.Directory == "" {
+		config.Directory = defaultSpoolConfiguration.Directory
+	}
+	if abs, err := filepath.Abs(config.Directory); err == nil {
+		config.Directory = abs
+	}
+	spools.Lock()
+	defer spools.Unlock()
+
+	if spool, ok := spools.open[config.Directory]; ok {
+		spool.mut.Lock()
+		spool.config = spoolDefaults(config)
+		spool.mut.Unlock()
+		spool.refs++
+		return spool, nil
+	}
+
+	spool, err := newKafkaSpool(config)
+	if err != nil {
+		return nil, err
+	}
+	spool.refs = 1
+	spools.open[config.Directory] = spool
+	return spool, nil
+}
+
+// release closes the spool once no producer is using it
+func (s *kafkaSpool) release() error {
+	spools.Lock()
+	defer spools.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+	delete(spools.open, s.config.Directory)
+	return s.close()
+}
+
+// spoolDefaults returns the spool config with defaults for unset values
+func spoolDefaults(config SpoolConfiguration) SpoolConfiguration {
+	if config.Directory == "" {
+		config.Directory = defaultSpoolConfiguration.Directory
+	}
+	if config.ReplayFreq == 0 {
+		config.ReplayFreq = defaultSpoolConfiguration.ReplayFreq
+	}
+	return config
+}
+
+// newKafkaSpool returns a spool instance, existing segments are kept for replay
+func newKafkaSpool(config SpoolConfiguration) (*kafkaSpool, error) {
+	spool := kafkaSpool{
+		config: spoolDefaults(config),
+	}
+
+	err := os.MkdirAll(spool.config.Directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	segments, err := spool.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		info, err := os.Stat(segment)
+		if err != nil {
+			return nil, err
+		}
+		spool.size += info.Size()
+	}
+	return &spool, nil
+}
+
+// segments returns the segment file names oldest first
+func (s *kafkaSpool) segments() ([]string, error) {
+	segments, err := filepath.Glob(filepath.Join(s.config.Directory,
+		"*"+spoolExtension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+// empty returns true if there are no spooled records
+func (s *kafkaSpool) empty() bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.size == 0
+}
+
+// write appends a record to the current segment
+func (s *kafkaSpool) write(rec *spoolRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.config.MaxBytes > 0 && s.size+int64(len(line)) > s.config.MaxBytes {
+		return errSpoolFull
+	}
+
+	if s.file != nil && s.segSize >= spoolSegmentSize {
+		s.rotate()
+	}
+	if s.file == nil {
+		name := fmt.Sprintf("%020d%s", time.Now().UnixNano(), spoolExtension)
+		s.file, err = os.OpenFile(filepath.Join(s.config.Directory, name),
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		s.segSize = 0
+	}
+
+	n, err := s.file.Write(line)
+	s.segSize += int64(n)
+	s.size += int64(n)
+	return err
+}
+
+// rotate closes the current segment so the next write starts a new one
+// must be called with the mutex held
+func (s *kafkaSpool) rotate() {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// oldest returns the name and records of the oldest segment
+// the segment is rotated out first if it is still being appended
+func (s *kafkaSpool) oldest() (string, []*spoolRecord, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	segments, err := s.segments()
+	if err != nil || len(segments) == 0 {
+		return "", nil, err
+	}
+	segment := segments[0]
+	if s.file != nil && s.file.Name() == segment {
+		s.rotate()
+	}
+
+	file, err := os.Open(segment)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	var records []*spoolRecord
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			rec := new(spoolRecord)
+			if jerr := json.Unmarshal(line, rec); jerr != nil {
+				// a partial record left by a crash is skipped
+				fmt.Fprintf(os.Stderr, "Kafka spool record skipped: %s\n",
+					jerr.Error())
+			} else {
+				records = append(records, rec)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", nil, err
+		}
+	}
+	return segment, records, nil
+}
+
+// remove deletes a segment that has been replayed or expired
+func (s *kafkaSpool) remove(segment string) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.file != nil && s.file.Name() == segment {
+		s.rotate()
+	}
+	info, err := os.Stat(segment)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(segment); err != nil {
+		return err
+	}
+	s.size -= info.Size()
+	return nil
+}
+
+// expire removes segments not written to within MaxAge
+// returns the number of records discarded
+func (s *kafkaSpool) expire() uint64 {
+	var expired uint64
+
+	s.mut.Lock()
+	maxAge := s.config.MaxAge
+	segments, err := s.segments()
+	s.mut.Unlock()
+	if maxAge <= 0 || err != nil {
+		return 0
+	}
+
+	for _, segment := range segments {
+		info, err := os.Stat(segment)
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		content, err := ioutil.ReadFile(segment)
+		if err != nil {
+			continue
+		}
+		if s.remove(segment) == nil {
+			expired += uint64(bytes.Count(content, []byte{'\n'}))
+		}
+	}
+	return expired
+}
+
+// close syncs and closes the current segment
+func (s *kafkaSpool) close() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Sync()
+	if cerr := s.file.Close(); cerr != nil {
+		err = cerr
+	}
+	s.file = nil
+	return err
+}
+
+// replayBatch tracks the results of the records of a replayed segment
+type replayBatch struct {
+	wg     sync.WaitGroup
+	failed int32 // must access atomically
+}
+
+// done records the result of a replayed record
+func (b *replayBatch) done(err error) {
+	if err != nil {
+		atomic.AddInt32(&b.failed, 1)
+	}
+	b.wg.Done()
+}
+
+// spoolMessage writes a message to the spool instead of the producer
+func (kp *KafkaProducer) spoolMessage(pm *sarama.ProducerMessage) error {
+	rec, err := newSpoolRecord(pm)
+	if err == nil {
+		err = kp.spool.write(rec)
+	}
+	if err != nil {
+		return err
+	}
+	atomic.AddUint64(&kp.spooled, 1)
+	return nil
+}
+
+// inputMessage hands a message to the producer
+// with a spool the wait is bounded and the message is spooled on timeout
+func (kp *KafkaProducer) inputMessage(pm *sarama.ProducerMessage) error {
+	if kp.spool == nil {
+		kp.producer.Input() <- pm
+		atomic.AddUint64(&kp.sent, 1)
+		return nil
+	}
+
+	// keep order by spooling while unhealthy or older records are pending
+	if !kp.isHealthy() || !kp.spool.empty() {
+		return kp.spoolOrFallback(pm)
+	}
+
+	timer := time.NewTimer(spoolInputTimeout)
+	defer timer.Stop()
+	select {
+	case kp.producer.Input() <- pm:
+		atomic.AddUint64(&kp.sent, 1)
+		return nil
+	case <-timer.C:
+		kp.setHealthy(false)
+		return kp.spoolOrFallback(pm)
+	}
+}
+
+// spoolOrFallback writes a message to the spool, messages the spool does
+// not take go to the fallback sink like failed messages or are dropped
+func (kp *KafkaProducer) spoolOrFallback(pm *sarama.ProducerMessage) error {
+	err := kp.spoolMessage(pm)
+	if err == nil {
+		return nil
+	}
+	var msg []byte
+	if pm.Value != nil {
+		msg, _ = pm.Value.Encode()
+	}
+	if kp.fallbackMessage(msg) {
+		return nil
+	}
+	atomic.AddUint64(&kp.dropped, 1)
+	return err
+}
+
+// isHealthy returns false after a delivery failure until a delivery succeeds
+func (kp *KafkaProducer) isHealthy() bool {
+	return atomic.LoadInt32(&kp.healthy) != 0
+}
+
+// setHealthy records the producer health
+func (kp *KafkaProducer) setHealthy(healthy bool) {
+	if healthy {
+		atomic.StoreInt32(&kp.healthy, 1)
+	} else {
+		atomic.StoreInt32(&kp.healthy, 0)
+	}
+}
+
+// replaySpool periodically expires and replays spooled segments
+// runs until stopReplay is closed, producers sharing the spool take turns
+func (kp *KafkaProducer) replaySpool() {
+	defer close(kp.replayDone)
+
+	ticker := time.NewTicker(spoolDefaults(kp.config.SpoolCfg).ReplayFreq)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-kp.stopReplay:
+			return
+		case <-ticker.C:
+		}
+
+		kp.spool.replayMut.Lock()
+		if expired := kp.spool.expire(); expired > 0 {
+			atomic.AddUint64(&kp.dropped, expired)
+			fmt.Fprintf(os.Stderr, "Kafka spool expired %d messages\n", expired)
+		}
+
+		// replay segments oldest first until one fails or the spool is empty
+		for !kp.spool.empty() && !kp.stopping() && kp.replaySegment() {
+		}
+		kp.spool.replayMut.Unlock()
+	}
+}
+
+// stopping returns true once the replayer has been asked to stop
+func (kp *KafkaProducer) stopping() bool {
+	select {
+	case <-kp.stopReplay:
+		return true
+	default:
+		return false
+	}
+}
+
+// replaySegment sends the oldest segment and waits for the results
+// the segment is removed only if every record was delivered, if not it
+// is replayed again later so consumers may see duplicate cloudevents IDs
+func (kp *KafkaProducer) replaySegment() bool {
+	segment, records, err := kp.spool.oldest()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Kafka spool replay failed: %s\n", err.Error())
+		return false
+	}
+	if segment == "" {
+		return false
+	}
+
+	batch := &replayBatch{}
+	batch.wg.Add(len(records))
+	for _, rec := range records {
+		kp.producer.Input() <- rec.message(batch)
+	}
+	batch.wg.Wait()
+
+	if atomic.LoadInt32(&batch.failed) > 0 {
+		kp.setHealthy(false)
+		return false
+	}
+
+	if err = kp.spool.remove(segment); err != nil {
+		fmt.Fprintf(os.Stderr, "Kafka spool remove failed: %s\n", err.Error())
+		return false
+	}
+	atomic.AddUint64(&kp.replayed, uint64(len(records)))
+	kp.setHealthy(true)
+	return true
+}
@@ -0,0 +1,285 @@
+package logger
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogNetworkType provides syslog transport type
+type syslogNetworkType string
+
+// Supported syslog transports
+const (
+	SyslogUDP      syslogNetworkType = "udp" // default
+	SyslogTCP      syslogNetworkType = "tcp"
+	SyslogTLS      syslogNetworkType = "tls"
+	SyslogUnix     syslogNetworkType = "unix"     // stream socket
+	SyslogUnixgram syslogNetworkType = "unixgram" // datagram socket
+)
+
+// syslogFormatType provides syslog message format type
+type syslogFormatType string
+
+// Supported syslog message formats
+const (
+	SyslogRFC5424 syslogFormatType = "rfc5424" // default
+	SyslogRFC3164 syslogFormatType = "rfc3164" // BSD syslog
+)
+
+// syslogFramingType provides syslog stream framing type
+type syslogFramingType string
+
+// Supported syslog framing for stream transports, see RFC 6587
+const (
+	SyslogOctetCounting syslogFramingType = "octet-counting" // default
+	SyslogNewline       syslogFramingType = "newline"
+)
+
+// SyslogConfiguration provides syslog sink configuration type
+type SyslogConfiguration struct {
+	Network  syslogNetworkType
+	Address  string // host:port or socket path
+	Facility string // kern, user, daemon, local0 ... local7
+	AppName  string // defaults to the program name
+	Hostname string // defaults to the host name
+	Format   syslogFormatType
+	Framing  syslogFramingType // ignored by datagram transports
+	SDID     string            // structured data ID for WithFields data
+	TLSCfg   *tls.Config       `json:"-" yaml:"-"`
+}
+
+// syslogFacilities maps facility names to facility codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// getSyslogSeverity converts log level to syslog severity
+func getSyslogSeverity(level LevelType) int {
+	switch level {
+	case DebugType:
+		return 7 // debug
+	case WarnType:
+		return 4 // warning
+	case ErrorType:
+		return 3 // err
+	case FatalType:
+		return 2 // crit
+	case PanicType:
+		return 1 // alert
+	case InfoType:
+		fallthrough
+	default:
+		return 6 // informational
+	}
+}
+
+// syslogWriter formats records and sends them to a syslog server
+type syslogWriter struct {
+	config   SyslogConfiguration
+	facility int
+	pid      int
+	mut      sync.Mutex
+	conn     net.Conn
+}
+
+// newSyslogWriter returns a syslog writer connected to the server
+func newSyslogWriter(config SyslogConfiguration) (*syslogWriter, error) {
+	sw := syslogWriter{
+		config:   config,
+		facility: syslogFacilities[config.Facility],
+		pid:      os.Getpid(),
+	}
+	if config.Network == "" {
+		sw.config.Network = defaultSyslogConfiguration.Network
+	}
+	if config.Address == "" {
+		sw.config.Address = defaultSyslogConfiguration.Address
+	}
+	if config.Facility == "" {
+		sw.facility = syslogFacilities[defaultSyslogConfiguration.Facility]
+	}
+	if config.AppName == "" {
+		sw.config.AppName = filepath.Base(os.Args[0])
+	}
+	if config.Hostname == "" {
+		sw.config.Hostname, _ = os.Hostname()
+	}
+	if config.Format == "" {
+		sw.config.Format = defaultSyslogConfiguration.Format
+	}
+	if config.Framing == "" {
+		sw.config.Framing = defaultSyslogConfiguration.Framing
+	}
+	if config.SDID == "" {
+		sw.config.SDID = defaultSyslogConfiguration.SDID
+	}
+
+	if err := sw.connect(); err != nil {
+		return nil, err
+	}
+	return &sw, nil
+}
+
+// connect dials the syslog server, must be called with the mutex held
+func (sw *syslogWriter) connect() error {
+	var conn net.Conn
+	var err error
+
+	if sw.config.Network == SyslogTLS {
+		conn, err = tls.Dial("tcp", sw.config.Address, sw.config.TLSCfg)
+	} else {
+		conn, err = net.Dial(string(sw.config.Network), sw.config.Address)
+	}
+	if err != nil {
+		return err
+	}
+	sw.conn = conn
+	return nil
+}
+
+// datagram returns true if each message is sent as one datagram
+func (sw *syslogWriter) datagram() bool {
+	return sw.config.Network == SyslogUDP ||
+		sw.config.Network == SyslogUnixgram
+}
+
+// write sends a record, reconnecting once if the connection was lost
+func (sw *syslogWriter) write(level LevelType, t time.Time, msg string,
+	fields map[string]interface{}) error {
+
+	frame := sw.frame(sw.format(level, t, msg, fields))
+
+	sw.mut.Lock()
+	defer sw.mut.Unlock()
+
+	if sw.conn == nil {
+		return fmt.Errorf("Syslog writer closed")
+	}
+	if _, err := sw.conn.Write(frame); err != nil {
+		sw.conn.Close()
+		if err = sw.connect(); err != nil {
+			return err
+		}
+		_, err = sw.conn.Write(frame)
+		return err
+	}
+	return nil
+}
+
+// format returns the syslog message for a record
+func (sw *syslogWriter) format(level LevelType, t time.Time, msg string,
+	fields map[string]interface{}) []byte {
+
+	var b strings.Builder
+	pri := sw.facility*8 + getSyslogSeverity(level)
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if sw.config.Format == SyslogRFC3164 {
+		// <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG key="value" ...
+		fmt.Fprintf(&b, "<%d>%s %s %s[%d]: %s", pri,
+			t.Format(time.Stamp), sw.config.Hostname, sw.config.AppName,
+			sw.pid, msg)
+		for _, key := range keys {
+			fmt.Fprintf(&b, " %s=%q", key, fmt.Sprint(fields[key]))
+		}
+		return []byte(b.String())
+	}
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - ", pri,
+		t.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(sw.config.Hostname),
+		syslogHeaderField(sw.config.AppName), sw.pid)
+	if len(keys) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + sw.config.SDID)
+		for _, key := range keys {
+			fmt.Fprintf(&b, " %s=\"%s\"", syslogParamName(key),
+				syslogParamValue(fmt.Sprint(fields[key])))
+		}
+		b.WriteString("]")
+	}
+	if msg != "" {
+		b.WriteString(" " + msg)
+	}
+	return []byte(b.String())
+}
+
+// frame adds the stream framing to a message
+func (sw *syslogWriter) frame(msg []byte) []byte {
+	if sw.datagram() {
+		return msg
+	}
+	if sw.config.Framing == SyslogNewline {
+		return append(msg, '\n')
+	}
+	return append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+}
+
+// syslogHeaderField returns a header field as printable ASCII or "-"
+func syslogHeaderField(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// syslogParamName returns a valid structured data parameter name
+func syslogParamName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+// syslogParamValue escapes a structured data parameter value
+func syslogParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// Sync meets the sinkCloser interface, messages are not buffered
+func (sw *syslogWriter) Sync() error {
+	return nil
+}
+
+// closeContext closes the connection to the syslog server
+func (sw *syslogWriter) closeContext(ctx context.Context) error {
+	sw.mut.Lock()
+	defer sw.mut.Unlock()
+
+	if sw.conn == nil {
+		return nil
+	}
+	err := sw.conn.Close()
+	sw.conn = nil
+	return err
+}
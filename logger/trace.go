@@ -0,0 +1,96 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Keys for trace correlation fields added from the active span
+const (
+	TraceIDKey    = "trace_id"
+	SpanIDKey     = "span_id"
+	TraceFlagsKey = "trace_flags"
+	TraceStateKey = "trace_state"
+)
+
+// Keys for the cloudevents distributed tracing extension attributes
+// also used as kafka header names
+const (
+	CETraceParentKey = "traceparent"
+	CETraceStateKey  = "tracestate"
+)
+
+// TraceFields returns the trace correlation fields of the span in ctx
+// returns nil if there is no valid span, registered as a context extractor
+func TraceFields(ctx context.Context) LogFields {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	fields := LogFields{
+		TraceIDKey:    sc.TraceID().String(),
+		SpanIDKey:     sc.SpanID().String(),
+		TraceFlagsKey: sc.TraceFlags().String(),
+	}
+	if state := sc.TraceState().String(); state != "" {
+		fields[TraceStateKey] = state
+	}
+	return fields
+}
+
+// traceContext holds the trace correlation fields of a log record
+type traceContext struct {
+	traceID string
+	spanID  string
+	flags   string
+	state   string
+}
+
+// set records a trace correlation field, returns false for other keys
+func (tc *traceContext) set(key string, value string) bool {
+	switch key {
+	case TraceIDKey:
+		tc.traceID = value
+	case SpanIDKey:
+		tc.spanID = value
+	case TraceFlagsKey:
+		tc.flags = value
+	case TraceStateKey:
+		tc.state = value
+	default:
+		return false
+	}
+	return true
+}
+
+// traceParent returns the W3C traceparent value or "" without a span
+func (tc *traceContext) traceParent() string {
+	if tc.traceID == "" || tc.spanID == "" {
+		return ""
+	}
+	flags := tc.flags
+	if flags == "" {
+		flags = "00"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", tc.traceID, tc.spanID, flags)
+}
+
+// ceAddTraceFields sets the distributed tracing extension attributes
+// from the trace correlation fields in the message
+func ceAddTraceFields(msgMap map[string]interface{}) {
+	var tc traceContext
+	for _, key := range []string{TraceIDKey, SpanIDKey, TraceFlagsKey,
+		TraceStateKey} {
+		if value, ok := msgMap[key].(string); ok {
+			tc.set(key, value)
+		}
+	}
+	if parent := tc.traceParent(); parent != "" {
+		msgMap[CETraceParentKey] = parent
+		if tc.state != "" {
+			msgMap[CETraceStateKey] = tc.state
+		}
+	}
+}
@@ -3,11 +3,16 @@
 package logger
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/buffer"
@@ -18,12 +23,16 @@ import (
 type zapLogger struct {
 	sugaredLogger *zap.SugaredLogger
 	kafkaWriter   *ZapKafkaWriter
+	sinks         *logSinks
+	level         zap.AtomicLevel
+	kafkaFuncs    *kafkaFuncs
 }
 
 // ceEncoder provides wrapper for the JSONEncoder (to insert CE fields)
 type ceEncoder struct {
 	zapcore.Encoder
 	fields []zapcore.Field
+	trace  traceContext // trace fields added by WithFields
 }
 
 // Clone meets the interface for the zapcore encoder
@@ -31,17 +40,442 @@ func (ce *ceEncoder) Clone() zapcore.Encoder {
 	return &ceEncoder{
 		ce.Encoder.Clone(),
 		ce.fields,
+		ce.trace,
 	}
 }
 
+// AddString meets the interface for the zapcore encoder
+// trace fields are kept to set the distributed tracing extension
+func (ce *ceEncoder) AddString(key, value string) {
+	ce.trace.set(key, value)
+	ce.Encoder.AddString(key, value)
+}
+
 // EncodeEntry meets the interface for the zapcore encoder
 func (ce *ceEncoder) EncodeEntry(entry zapcore.Entry,
 	fields []zapcore.Field) (*buffer.Buffer, error) {
 	// CE fields are added here, not by using WithFields
 	fields = append(fields, ce.fields...)
+
+	trace := ce.trace
+	for _, field := range fields {
+		if field.Type == zapcore.StringType {
+			trace.set(field.Key, field.String)
+		}
+	}
+	if parent := trace.traceParent(); parent != "" {
+		fields = append(fields, zap.String(CETraceParentKey, parent))
+		if trace.state != "" {
+			fields = append(fields, zap.String(CETraceStateKey, trace.state))
+		}
+	}
 	return ce.Encoder.EncodeEntry(entry, fields)
 }
 
+// ceIDCore provides a tee of cores that gives each record one cloudevents
+// id, added to the records written to cores with cloudevents format
+type ceIDCore struct {
+	cores       []zapcore.Core
+	ceFormat    []bool
+	cloudEvents *CloudEvents
+}
+
+// Enabled meets the interface for the zapcore core
+func (c *ceIDCore) Enabled(level zapcore.Level) bool {
+	for _, core := range c.cores {
+		if core.Enabled(level) {
+			return true
+		}
+	}
+	return false
+}
+
+// With meets the interface for the zapcore core
+func (c *ceIDCore) With(fields []zapcore.Field) zapcore.Core {
+	cores := make([]zapcore.Core, len(c.cores))
+	for i, core := range c.cores {
+		cores[i] = core.With(fields)
+	}
+	return &ceIDCore{cores, c.ceFormat, c.cloudEvents}
+}
+
+// Check meets the interface for the zapcore core
+func (c *ceIDCore) Check(entry zapcore.Entry,
+	checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write meets the interface for the zapcore core
+// the id is only generated if a core with cloudevents format is enabled
+func (c *ceIDCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	var errs []error
+	var idFields []zapcore.Field
+
+	for i, core := range c.cores {
+		if !core.Enabled(entry.Level) {
+			continue
+		}
+		coreFields := fields
+		if c.ceFormat[i] {
+			if idFields == nil {
+				id, err := c.cloudEvents.ceRecordID(entry.Message)
+				if err != nil {
+					return err
+				}
+				idFields = fields[:len(fields):len(fields)]
+				if id != "" {
+					idFields = append(idFields, zap.String(CEIDKey, id))
+				}
+			}
+			coreFields = idFields
+		}
+		if err := core.Write(entry, coreFields); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Sync meets the interface for the zapcore core
+func (c *ceIDCore) Sync() error {
+	var errs []error
+	for _, core := range c.cores {
+		if err := core.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// kafkaFuncsFieldKey is the key of the field carrying the kafka functions
+const kafkaFuncsFieldKey = "_kafkafuncs"
+
+// kafkaFuncsField returns a field carrying the kafka functions of a logger
+// encoders skip the field, only the kafka core uses it
+func kafkaFuncsField(funcs *kafkaFuncs) zapcore.Field {
+	return zapcore.Field{
+		Key:       kafkaFuncsFieldKey,
+		Type:      zapcore.SkipType,
+		Interface: funcs,
+	}
+}
+
+// kafkaCore provides a zap core that writes to kafka using the filter and
+// key functions added to its logger
+// with a kafka layout the fields of each record are passed to the writer,
+// otherwise records are encoded and the writer decodes them
+type kafkaCore struct {
+	zapcore.LevelEnabler
+	encoder zapcore.Encoder // used without layout
+	layout  *kafkaLayout
+	fields  map[string]interface{} // added by WithFields, used with layout
+	writer  *ZapKafkaWriter
+	funcs   *kafkaFuncs
+}
+
+// newKafkaCore returns a zap core for the kafka writer
+func newKafkaCore(encoder zapcore.Encoder, layout *kafkaLayout,
+	writer *ZapKafkaWriter, enabler zapcore.LevelEnabler) zapcore.Core {
+	return &kafkaCore{
+		LevelEnabler: enabler,
+		encoder:      encoder,
+		layout:       layout,
+		fields:       map[string]interface{}{},
+		writer:       writer,
+	}
+}
+
+// addFields returns the core fields with more fields added
+// values are converted to those the json encoder would write
+func (c *kafkaCore) addFields(fields []zapcore.Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	for key, value := range enc.Fields {
+		enc.Fields[key] = zapFieldValue(value, c.layout.timeKey != "")
+	}
+	for key, value := range c.fields {
+		if _, ok := enc.Fields[key]; !ok {
+			enc.Fields[key] = value
+		}
+	}
+	return enc.Fields
+}
+
+// zapFieldValue returns a value added to the map encoder as the production
+// json encoder writes it, which differs for times, durations, complex
+// numbers and floats that are not numbers
+func zapFieldValue(value interface{}, timestamps bool) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		if timestamps {
+			return v.Format(time.RFC3339)
+		}
+		return float64(v.UnixNano()) / float64(time.Second)
+	case time.Duration:
+		return v.Seconds()
+	case complex128:
+		return strings.Trim(strconv.FormatComplex(v, 'f', -1, 128), "()")
+	case complex64:
+		return strings.Trim(strconv.FormatComplex(complex128(v), 'f', -1, 64),
+			"()")
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return strconv.FormatFloat(float64(v), 'f', -1, 32)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = zapFieldValue(item, timestamps)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = zapFieldValue(item, timestamps)
+		}
+	}
+	return value
+}
+
+// With meets the interface for the zapcore core
+func (c *kafkaCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	if c.encoder != nil {
+		clone.encoder = c.encoder.Clone()
+	}
+	var added []zapcore.Field
+	for _, field := range fields {
+		if field.Type == zapcore.SkipType && field.Key == kafkaFuncsFieldKey {
+			clone.funcs = field.Interface.(*kafkaFuncs)
+			continue
+		}
+		if c.encoder != nil {
+			field.AddTo(clone.encoder)
+		}
+		added = append(added, field)
+	}
+	if c.layout != nil {
+		clone.fields = c.addFields(added)
+	}
+	return &clone
+}
+
+// Check meets the interface for the zapcore core
+func (c *kafkaCore) Check(entry zapcore.Entry,
+	checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// syncOnFatal syncs a core after a record above error level as zap may
+// exit or panic next, sync errors are ignored as zapcore ioCore does
+func syncOnFatal(level zapcore.Level, core zapcore.Core) {
+	if level > zapcore.ErrorLevel {
+		core.Sync()
+	}
+}
+
+// Write meets the interface for the zapcore core
+func (c *kafkaCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if err := c.write(entry, fields); err != nil {
+		return err
+	}
+	syncOnFatal(entry.Level, c)
+	return nil
+}
+
+// write sends the record to the kafka writer
+func (c *kafkaCore) write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if c.layout != nil {
+		msgMap := c.layout.record(entry.Level.String(), entry.Time,
+			entry.Message, c.addFields(fields))
+		return c.writer.writeFields(msgMap, c.funcs)
+	}
+
+	buf, err := c.encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+	_, err = c.writer.writeFuncs(buf.Bytes(), c.funcs)
+	return err
+}
+
+// Sync meets the interface for the zapcore core
+func (c *kafkaCore) Sync() error {
+	return c.writer.Sync()
+}
+
+// recordWriter is implemented by sinks that need the level, time and
+// selected fields of each record as well as the encoded record
+type recordWriter interface {
+	write(level LevelType, t time.Time, line []byte,
+		fields map[string]interface{}) error
+	Sync() error
+}
+
+// recordCore provides a zap core that writes to a record writer
+type recordCore struct {
+	zapcore.LevelEnabler
+	encoder zapcore.Encoder
+	writer  recordWriter
+	keys    []string               // keys of the fields the writer needs
+	fields  map[string]interface{} // those fields added by WithFields
+}
+
+// newRecordCore returns a zap core for a record writer
+func newRecordCore(encoder zapcore.Encoder, writer recordWriter,
+	keys []string, enabler zapcore.LevelEnabler) zapcore.Core {
+	return &recordCore{
+		LevelEnabler: enabler,
+		encoder:      encoder,
+		writer:       writer,
+		keys:         keys,
+		fields:       map[string]interface{}{},
+	}
+}
+
+// addFields returns the fields the writer needs with those of more fields
+func (c *recordCore) addFields(fields []zapcore.Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for key, value := range c.fields {
+		enc.Fields[key] = value
+	}
+	for _, field := range fields {
+		for _, key := range c.keys {
+			if field.Key == key {
+				field.AddTo(enc)
+				break
+			}
+		}
+	}
+	return enc.Fields
+}
+
+// With meets the interface for the zapcore core
+func (c *recordCore) With(fields []zapcore.Field) zapcore.Core {
+	encoder := c.encoder.Clone()
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+	return &recordCore{
+		LevelEnabler: c.LevelEnabler,
+		encoder:      encoder,
+		writer:       c.writer,
+		keys:         c.keys,
+		fields:       c.addFields(fields),
+	}
+}
+
+// Check meets the interface for the zapcore core
+func (c *recordCore) Check(entry zapcore.Entry,
+	checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write meets the interface for the zapcore core
+func (c *recordCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+	err = c.writer.write(getLevelType(entry.Level), entry.Time, buf.Bytes(),
+		c.addFields(fields))
+	if err != nil {
+		return err
+	}
+	syncOnFatal(entry.Level, c)
+	return nil
+}
+
+// Sync meets the interface for the zapcore core
+func (c *recordCore) Sync() error {
+	return c.writer.Sync()
+}
+
+// messageWriter is implemented by sinks that need the level, time, message
+// and fields of each record instead of the encoded record
+type messageWriter interface {
+	write(level LevelType, t time.Time, msg string,
+		fields map[string]interface{}) error
+	Sync() error
+}
+
+// messageCore provides a zap core that writes to a message writer
+type messageCore struct {
+	zapcore.LevelEnabler
+	writer messageWriter
+	fields map[string]interface{} // added by WithFields
+}
+
+// newMessageCore returns a zap core for a message writer
+func newMessageCore(writer messageWriter,
+	enabler zapcore.LevelEnabler) zapcore.Core {
+	return &messageCore{
+		LevelEnabler: enabler,
+		writer:       writer,
+		fields:       map[string]interface{}{},
+	}
+}
+
+// addFields returns the core fields with more fields added
+func (c *messageCore) addFields(fields []zapcore.Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for key, value := range c.fields {
+		enc.Fields[key] = value
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	return enc.Fields
+}
+
+// With meets the interface for the zapcore core
+func (c *messageCore) With(fields []zapcore.Field) zapcore.Core {
+	return &messageCore{
+		LevelEnabler: c.LevelEnabler,
+		writer:       c.writer,
+		fields:       c.addFields(fields),
+	}
+}
+
+// Check meets the interface for the zapcore core
+func (c *messageCore) Check(entry zapcore.Entry,
+	checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write meets the interface for the zapcore core
+func (c *messageCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	err := c.writer.write(getLevelType(entry.Level), entry.Time,
+		entry.Message, c.addFields(fields))
+	if err != nil {
+		return err
+	}
+	syncOnFatal(entry.Level, c)
+	return nil
+}
+
+// Sync meets the interface for the zapcore core
+func (c *messageCore) Sync() error {
+	return c.writer.Sync()
+}
+
 // getEncoder returns a zap encoder
 func getEncoder(format FormatType, config LoggerConfiguration,
 	fields LogFields) zapcore.Encoder {
@@ -60,6 +494,12 @@ func getEncoder(format FormatType, config LoggerConfiguration,
 	switch format {
 	case JSONFormat:
 		return zapcore.NewJSONEncoder(encoderConfig)
+	case ECSFormat:
+		return newECSEncoder(config)
+	case GELFFormat:
+		return newGELFEncoder(config)
+	case LogfmtFormat:
+		return newLogfmtEncoder(config)
 	case CEFormat:
 		// Change keys for cloudevents
 		if config.EnableCloudEvents {
@@ -80,6 +520,7 @@ func getEncoder(format FormatType, config LoggerConfiguration,
 		return &ceEncoder{
 			zapcore.NewJSONEncoder(encoderConfig),
 			ceFields,
+			traceContext{},
 		}
 	case TextFormat:
 		fallthrough
@@ -111,6 +552,36 @@ func getZapLevel(level LevelType) zapcore.Level {
 	}
 }
 
+// getLevelType converts zap log level to log level
+func getLevelType(level zapcore.Level) LevelType {
+	switch level {
+	case zapcore.DebugLevel:
+		return DebugType
+	case zapcore.WarnLevel:
+		return WarnType
+	case zapcore.ErrorLevel:
+		return ErrorType
+	case zapcore.FatalLevel:
+		return FatalType
+	case zapcore.PanicLevel, zapcore.DPanicLevel:
+		return PanicType
+	case zapcore.InfoLevel:
+		fallthrough
+	default:
+		return InfoType
+	}
+}
+
+// getSinkLevel returns the level of a sink
+// a sink without a level of its own follows the log level
+func getSinkLevel(sinkLevel LevelType,
+	level zap.AtomicLevel) zapcore.LevelEnabler {
+	if sinkLevel == "" {
+		return level
+	}
+	return getZapLevel(sinkLevel)
+}
+
 // zapDebugHook is a hook for testing
 func zapDebugHook(entry zapcore.Entry) error {
 	fmt.Fprintf(os.Stderr, "%+v\n", entry)
@@ -122,9 +593,12 @@ func newZapLogger(config LoggerConfiguration) (Logger, error) {
 	var kafkaWriter *ZapKafkaWriter
 	var cloudEvents *CloudEvents
 	var fields LogFields
+	var fwriter io.Writer
 	var err error
-	level := getZapLevel(config.LogLevel)
+	level := zap.NewAtomicLevelAt(getZapLevel(config.LogLevel))
 	cores := []zapcore.Core{}
+	ceFormat := []bool{}
+	sinks := &logSinks{}
 
 	if config.EnableCloudEvents {
 		cloudEvents = newCloudEvents(config.CloudEventsCfg)
@@ -137,62 +611,135 @@ func newZapLogger(config LoggerConfiguration) (Logger, error) {
 		core := zapcore.NewCore(encoder, writer, zapcore.DebugLevel)
 		core = zapcore.RegisterHooks(core, zapDebugHook)
 		cores = append(cores, core)
+		ceFormat = append(ceFormat, false)
 	}
 
 	if config.EnableKafka {
 		kafkaWriter, err = newZapKafkaWriter(config.KafkaProducerCfg,
 			cloudEvents, config.CloudEventsCfg)
 		if err != nil {
-			return nil, err
+			return nil, sinks.abort(err)
+		}
+		sinks.add(kafkaWriter)
+		var encoder zapcore.Encoder
+		layout := newKafkaLayout(config, cloudEvents)
+		if layout == nil {
+			encoder = getEncoder(config.KafkaFormat, config, fields)
 		}
-		encoder := getEncoder(config.KafkaFormat, config, fields)
-		core := zapcore.NewCore(encoder, kafkaWriter, level)
+		kafkaWriter.kp.setLayout(layout)
+		core := newKafkaCore(encoder, layout, kafkaWriter,
+			getSinkLevel(config.KafkaLevel, level))
 		cores = append(cores, core)
+		ceFormat = append(ceFormat, ceIDFormat(config, config.KafkaFormat))
 	}
 
 	if config.EnableConsole {
-		var cwriter io.Writer
-		if debugCapture != nil {
-			cwriter = debugCapture
-		} else if config.ConsoleWriter == Stderr {
-			cwriter = os.Stderr
-		} else {
-			cwriter = os.Stdout
-		}
+		cwriter := getConsoleWriter(config)
 		writer := zapcore.Lock(zapcore.AddSync(cwriter))
 		encoder := getEncoder(config.ConsoleFormat, config, fields)
-		core := zapcore.NewCore(encoder, writer, level)
+		core := zapcore.NewCore(encoder, writer,
+			getSinkLevel(config.ConsoleLevel, level))
 		cores = append(cores, core)
+		ceFormat = append(ceFormat, ceIDFormat(config, config.ConsoleFormat))
 	}
 
 	if config.EnableFile {
-		var fwriter io.Writer
-		fileLocation := config.FileLocation
-		if fileLocation == "" {
-			fileLocation = defaultLoggerConfiguration.FileLocation
-		}
-		if config.EnableRotation {
-			fwriter = rotationLogger(fileLocation, config.RotationCfg)
-		} else {
-			fwriter, err = os.OpenFile(fileLocation,
-				os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			if err != nil {
-				return nil, err
-			}
+		fwriter, err = getFileWriter(config)
+		if err != nil {
+			return nil, sinks.abort(err)
 		}
+		sinks.add(fileSink{fwriter})
 		writer := zapcore.AddSync(fwriter)
 		encoder := getEncoder(config.FileFormat, config, fields)
-		core := zapcore.NewCore(encoder, writer, level)
+		core := zapcore.NewCore(encoder, writer,
+			getSinkLevel(config.FileLevel, level))
+		cores = append(cores, core)
+		ceFormat = append(ceFormat, ceIDFormat(config, config.FileFormat))
+	}
+
+	if config.EnableSyslog {
+		swriter, err := newSyslogWriter(config.SyslogCfg)
+		if err != nil {
+			return nil, sinks.abort(err)
+		}
+		sinks.add(swriter)
+		core := newMessageCore(swriter, getSinkLevel(config.SyslogLevel, level))
+		cores = append(cores, core)
+		ceFormat = append(ceFormat, false)
+	}
+
+	if config.EnableHTTP {
+		format := getHTTPFormat(config.HTTPFormat)
+		hwriter := newHTTPWriter(config.HTTPCfg, format)
+		sinks.add(hwriter)
+		encoder := getEncoder(format, config, fields)
+		core := zapcore.NewCore(encoder, hwriter,
+			getSinkLevel(config.HTTPLevel, level))
 		cores = append(cores, core)
+		ceFormat = append(ceFormat, ceIDFormat(config, format))
+	}
+
+	if config.EnableLoki {
+		lwriter := newLokiWriter(config.LokiCfg)
+		sinks.add(lwriter)
+		encoder := getEncoder(config.LokiFormat, config, fields)
+		core := newRecordCore(encoder, lwriter, config.LokiCfg.LabelKeys,
+			getSinkLevel(config.LokiLevel, level))
+		cores = append(cores, core)
+		ceFormat = append(ceFormat, ceIDFormat(config, config.LokiFormat))
+	}
+
+	if config.EnableElastic {
+		ewriter := newElasticWriter(config.ElasticCfg, getServiceName(config))
+		sinks.add(ewriter)
+		encoder := getEncoder(getElasticFormat(config.ElasticFormat), config,
+			fields)
+		core := newRecordCore(encoder, ewriter, ewriter.index.keys(),
+			getSinkLevel(config.ElasticLevel, level))
+		cores = append(cores, core)
+		ceFormat = append(ceFormat, false)
+	}
+
+	if config.EnableGELF {
+		gwriter, err := newGELFWriter(config.GELFCfg)
+		if err != nil {
+			return nil, sinks.abort(err)
+		}
+		sinks.add(gwriter)
+		encoder := getEncoder(GELFFormat, config, fields)
+		core := zapcore.NewCore(encoder, gwriter,
+			getSinkLevel(config.GELFLevel, level))
+		cores = append(cores, core)
+		ceFormat = append(ceFormat, ceIDFormat(config, GELFFormat))
+	}
+
+	if config.EnableOTLP {
+		owriter, err := newOTLPWriter(config.OTLPCfg, getServiceName(config))
+		if err != nil {
+			return nil, sinks.abort(err)
+		}
+		sinks.add(owriter)
+		core := newMessageCore(owriter, getSinkLevel(config.OTLPLevel, level))
+		cores = append(cores, core)
+		ceFormat = append(ceFormat, false)
+	}
+
+	if kafkaWriter != nil {
+		kafkaWriter.kp.setFallback(getFallbackWriter(config, fwriter))
 	}
 
 	combinedCore := zapcore.NewTee(cores...)
+	if ceSharedIDs(config) {
+		combinedCore = &ceIDCore{cores, ceFormat, cloudEvents}
+	}
 	logger := zap.New(combinedCore).Sugar()
 	defer logger.Sync()
 
 	return &zapLogger{
 		sugaredLogger: logger,
 		kafkaWriter:   kafkaWriter,
+		sinks:         sinks,
+		level:         level,
 	}, nil
 }
 
@@ -282,6 +829,30 @@ func (l *zapLogger) Panicln(args ...interface{}) {
 	l.sugaredLogger.Panic(strings.TrimRight(fmt.Sprintln(args...), "\n"))
 }
 
+func (l *zapLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.sugaredLogger.Debugw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.sugaredLogger.Infow(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.sugaredLogger.Warnw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.sugaredLogger.Errorw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Fatalw(msg string, keysAndValues ...interface{}) {
+	l.sugaredLogger.Fatalw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Panicw(msg string, keysAndValues ...interface{}) {
+	l.sugaredLogger.Panicw(msg, keysAndValues...)
+}
+
 // WithFields adds fixed fields to each log record
 func (l *zapLogger) WithFields(fields LogFields) Logger {
 	var f = make([]interface{}, 0)
@@ -290,17 +861,56 @@ func (l *zapLogger) WithFields(fields LogFields) Logger {
 		f = append(f, v)
 	}
 	newLogger := l.sugaredLogger.With(f...)
-	return &zapLogger{newLogger, l.kafkaWriter}
+	return &zapLogger{newLogger, l.kafkaWriter, l.sinks, l.level,
+		l.kafkaFuncs}
+}
+
+// WithContext adds the fields extracted from ctx to each log record
+func (l *zapLogger) WithContext(ctx context.Context) Logger {
+	return withContext(l, ctx)
 }
 
-// WithKafkaFilterFn adds a filter function for each kafka record
+// WithKafkaFilterFn returns a logger adding a filter function for each of
+// its kafka records, after those of this logger
 func (l *zapLogger) WithKafkaFilterFn(filterFn FilterFunc) Logger {
-	l.kafkaWriter.kp.config.filterFn = filterFn
-	return l
+	return l.withKafkaFuncs(l.kafkaFuncs.withFilter(filterFn))
 }
 
-// WithKafkaKeyFn adds a key function for each kafka record
+// WithKafkaKeyFn returns a logger using a key function for its kafka records
 func (l *zapLogger) WithKafkaKeyFn(keyFn KeyFunc) Logger {
-	l.kafkaWriter.kp.config.keyFn = keyFn
-	return l
+	return l.withKafkaFuncs(l.kafkaFuncs.withKey(keyFn))
+}
+
+// withKafkaFuncs returns a logger using funcs for its kafka records
+func (l *zapLogger) withKafkaFuncs(funcs *kafkaFuncs) Logger {
+	newLogger := l.sugaredLogger.With(kafkaFuncsField(funcs))
+	return &zapLogger{newLogger, l.kafkaWriter, l.sinks, l.level, funcs}
+}
+
+// SetLevel changes the log level of this and all related loggers
+func (l *zapLogger) SetLevel(level LevelType) {
+	l.level.SetLevel(getZapLevel(level))
+}
+
+// GetLevel returns the current log level
+func (l *zapLogger) GetLevel() LevelType {
+	return getLevelType(l.level.Level())
+}
+
+// KafkaStats returns the kafka producer message counters
+func (l *zapLogger) KafkaStats() ProducerStats {
+	if l.kafkaWriter == nil {
+		return ProducerStats{}
+	}
+	return l.kafkaWriter.kp.Stats()
+}
+
+// Sync flushes the file and kafka sinks
+func (l *zapLogger) Sync() error {
+	return l.sinks.sync()
+}
+
+// Close flushes and releases all sinks, kafka is drained until ctx is done
+func (l *zapLogger) Close(ctx context.Context) error {
+	return l.sinks.close(ctx)
 }
@@ -3,6 +3,7 @@
 package logger
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"sync/atomic"
@@ -11,11 +12,11 @@ import (
 
 // ZapKafkaWriter is a zap WriteSyncer (io.Writer) that writes messages to Kafka
 type ZapKafkaWriter struct {
-	kp        *KafkaProducer
-	ce        *CloudEvents
-	closed    int32          // Nonzero if closing, must access atomically
-	pendingWg sync.WaitGroup // WaitGroup for pending messages
-	closeMut  sync.Mutex
+	kp       *KafkaProducer
+	ce       *CloudEvents
+	closed   int32         // Nonzero if closing, must access atomically
+	pending  pendingWrites // writes not yet passed to the producer
+	closeMut sync.Mutex
 }
 
 // newZapKafkaWriter returns a kafka io.writer instance
@@ -37,13 +38,21 @@ func newZapKafkaWriter(
 }
 
 // Sync satisfies zapcore.WriteSyncer interface, zapcore.AddSync works as well
+// Sync waits for pending writes to be acked or failed by the producer
 func (zw *ZapKafkaWriter) Sync() error {
-	return nil
+	zw.pending.wait()
+	return zw.kp.sync()
 }
 
 // Write sends byte slices to Kafka ignoring error responses (Thread-safe)
 // Write might block if the Input() channel of the AsyncProducer is full
 func (zw *ZapKafkaWriter) Write(msg []byte) (int, error) {
+	return zw.writeFuncs(msg, nil)
+}
+
+// writeFuncs sends a message using the filter and key functions of its logger
+func (zw *ZapKafkaWriter) writeFuncs(msg []byte, funcs *kafkaFuncs) (int,
+	error) {
 	if zw.Closed() {
 		return 0, syscall.EINVAL
 	}
@@ -52,13 +61,31 @@ func (zw *ZapKafkaWriter) Write(msg []byte) (int, error) {
 		return 0, errors.New("No producer defined")
 	}
 
-	zw.pendingWg.Add(1)
-	defer zw.pendingWg.Done()
+	epoch := zw.pending.start()
+	defer zw.pending.done(epoch)
 
-	err := zw.kp.sendMessage(msg)
+	err := zw.kp.sendMessage(msg, funcs)
 	return len(msg), err
 }
 
+// writeFields sends the fields of a record using the filter and key
+// functions of its logger, msgMap must not be used afterwards (Thread-safe)
+func (zw *ZapKafkaWriter) writeFields(msgMap map[string]interface{},
+	funcs *kafkaFuncs) error {
+	if zw.Closed() {
+		return syscall.EINVAL
+	}
+
+	if zw.kp.producer == nil {
+		return errors.New("No producer defined")
+	}
+
+	epoch := zw.pending.start()
+	defer zw.pending.done(epoch)
+
+	return zw.kp.sendFields(msgMap, funcs)
+}
+
 // Closed returns true if the writer is closed, false otherwise (Thread-safe)
 func (zw *ZapKafkaWriter) Closed() bool {
 	return atomic.LoadInt32(&zw.closed) != 0
@@ -66,6 +93,11 @@ func (zw *ZapKafkaWriter) Closed() bool {
 
 // Close must be called when the writer is no longer needed (Thread-safe)
 func (zw *ZapKafkaWriter) Close() (err error) {
+	return zw.closeContext(context.Background())
+}
+
+// closeContext waits for pending writes then drains the producer until ctx done
+func (zw *ZapKafkaWriter) closeContext(ctx context.Context) error {
 	zw.closeMut.Lock()
 	defer zw.closeMut.Unlock()
 
@@ -75,6 +107,6 @@ func (zw *ZapKafkaWriter) Close() (err error) {
 
 	atomic.StoreInt32(&zw.closed, 1)
 
-	zw.pendingWg.Wait()
-	return nil
+	zw.pending.wait()
+	return zw.kp.close(ctx)
 }